@@ -1,10 +1,13 @@
 package config
 
 import (
+	"github.com/lfxnxf/zdy_tools/discovery"
 	"github.com/lfxnxf/zdy_tools/resource/kafka"
 	"github.com/lfxnxf/zdy_tools/resource/redis"
 	"github.com/lfxnxf/zdy_tools/resource/sql"
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
 	"github.com/lfxnxf/zdy_tools/trace"
+	http_client "github.com/lfxnxf/zdy_tools/zd_http/client"
 	"github.com/lfxnxf/zdy_tools/zd_http/server"
 	rpc_client "github.com/lfxnxf/zdy_tools/zd_rpc/client"
 	rpc_server "github.com/lfxnxf/zdy_tools/zd_rpc/server"
@@ -15,15 +18,20 @@ type Instance interface {
 }
 
 type Config struct {
-	Log           Log                        `yaml:"log"`
-	Server        server.HttpServerConfig    `yaml:"server"`
-	RpcServer     rpc_server.RpcServerConfig `yaml:"rpc_server"`
-	RpcClient     []rpc_client.RpcClientConf `yaml:"rpc_client"`
-	Telemetry     trace.Config               `yaml:"telemetry"`
-	Database      []sql.GroupConfig          `yaml:"mysql"`
-	Redis         []redis.Conf               `yaml:"redis"`
-	KafkaProducer []kafka.ProducerConfig     `yaml:"kafka_producer_client"`
-	KafkaConsumer []kafka.ConsumeConfig      `yaml:"kafka_consume"`
+	Log           Log                         `yaml:"log"`
+	Server        server.HttpServerConfig     `yaml:"server"`
+	RpcServer     rpc_server.RpcServerConfig  `yaml:"rpc_server"`
+	RpcClient     []rpc_client.RpcClientConf  `yaml:"rpc_client"`
+	Consul        discovery.ConsulConfig      `yaml:"consul"`
+	RpcService    []upstream_config.Cluster   `yaml:"rpc_service"`
+	HttpService   []upstream_config.Cluster   `yaml:"http_service"`
+	HttpClient    []http_client.ProfileConfig `yaml:"http_client"`
+	Remote        http_client.RemoteConfig    `yaml:"remote"`
+	Telemetry     trace.Config                `yaml:"telemetry"`
+	Database      []sql.GroupConfig           `yaml:"mysql"`
+	Redis         []redis.Conf                `yaml:"redis"`
+	KafkaProducer []kafka.ProducerConfig      `yaml:"kafka_producer_client"`
+	KafkaConsumer []kafka.ConsumeConfig       `yaml:"kafka_consume"`
 }
 
 type Log struct {
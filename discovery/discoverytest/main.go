@@ -0,0 +1,28 @@
+// Package discoverytest 为使用服务发现的包提供测试辅助
+package discoverytest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+)
+
+// Main 初始化日志后在临时目录中运行测试，在TestMain中调用
+// upstream会把发现结果写到./data，在临时目录中运行避免写入源码目录和读到上次的结果
+func Main(m *testing.M) {
+	l := logging.New()
+	logging.DefaultKit = logging.NewKit(l, l, l, l, l, l)
+
+	dir, err := ioutil.TempDir("", "discoverytest")
+	if err != nil {
+		panic(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
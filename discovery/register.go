@@ -0,0 +1,165 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/registry"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/registry/consul"
+)
+
+const (
+	// weightTag upstream按该tag读取节点权重
+	weightTag = "__weight"
+
+	defaultCheckInterval   = 5000 // 毫秒
+	defaultCheckTimeout    = 1000 // 毫秒
+	defaultDeregisterAfter = 60   // 秒
+)
+
+var ErrNoRegistry = errors.New("discovery registry not initialized")
+
+// Manager 服务注册管理，支持从consul kv覆盖tag
+var Manager = registry.NewServiceManager(logging.Log(logging.GenLoggerName))
+
+// ConsulConfig 注册中心配置，addr为空不启用
+type ConsulConfig struct {
+	Addr   string `yaml:"addr"`
+	Scheme string `yaml:"scheme"`
+	Token  string `yaml:"token"`
+}
+
+// InitConsul 初始化consul作为服务注册和发现的后端
+func InitConsul(cfg ConsulConfig) error {
+	if len(cfg.Addr) == 0 {
+		return nil
+	}
+	scheme := cfg.Scheme
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+	backend, err := consul.NewBackend(&upstream_config.Consul{
+		Addr:   cfg.Addr,
+		Scheme: scheme,
+		Token:  cfg.Token,
+		Logger: logging.Log(logging.BalanceLoggerName),
+	})
+	if err != nil {
+		return err
+	}
+	registry.Default = backend
+	return nil
+}
+
+// RegisterConfig 服务启动时注册到consul，关闭时先注销再等待请求结束
+type RegisterConfig struct {
+	Enable          bool              `yaml:"enable"`
+	Name            string            `yaml:"name"`             // 注册的服务名，默认使用service_name
+	Addr            string            `yaml:"addr"`             // 注册的ip，默认本机ip
+	CheckDSN        string            `yaml:"check_dsn"`        // 健康检查，支持tcp、http、grpc，host为空时使用注册的地址，如http:///health
+	CheckInterval   int               `yaml:"check_interval"`   // 健康检查间隔（毫秒），默认5000
+	CheckTimeout    int               `yaml:"check_timeout"`    // 健康检查超时（毫秒），默认1000
+	DeregisterAfter int               `yaml:"deregister_after"` // 检查失败多久后自动注销（秒），默认60
+	Env             string            `yaml:"env"`              // env tag，默认online
+	Version         string            `yaml:"version"`          // version tag
+	Weight          int               `yaml:"weight"`           // 权重，默认100
+	Tags            map[string]string `yaml:"tags"`             // 其他tag
+}
+
+// Registration 一次服务注册
+type Registration struct {
+	reg *upstream_config.Register
+}
+
+// Register 注册服务，name、checkDSN为配置未指定时的默认值
+func Register(cfg RegisterConfig, name string, port int, checkDSN string) (*Registration, error) {
+	if registry.Default == nil {
+		return nil, ErrNoRegistry
+	}
+	if len(cfg.Name) > 0 {
+		name = cfg.Name
+	}
+	if len(name) == 0 {
+		return nil, errors.New("discovery register without service name")
+	}
+	addr := cfg.Addr
+	if len(addr) == 0 {
+		addr = upstream_config.LocalIPString()
+	}
+	if len(addr) == 0 {
+		return nil, errors.New("discovery register without local ip")
+	}
+
+	reg := upstream_config.NewRegister(name, addr, port)
+	if len(cfg.CheckDSN) > 0 {
+		checkDSN = cfg.CheckDSN
+	}
+	if len(checkDSN) > 0 {
+		dsn, err := checkAddress(checkDSN, addr, port)
+		if err != nil {
+			return nil, err
+		}
+		reg.ServiceCheckDSN = dsn
+	}
+	reg.ServiceCheckIntervalMs = defaultInt(cfg.CheckInterval, defaultCheckInterval)
+	reg.ServiceCheckTimeoutMs = defaultInt(cfg.CheckTimeout, defaultCheckTimeout)
+	reg.DeregisterCriticalServiceAfterSec = defaultInt(cfg.DeregisterAfter, defaultDeregisterAfter)
+	reg.ServiceTags = serviceTags(cfg)
+	// 与ServiceManager.InitServiceTags使用相同的kv路径
+	reg.TagsWatchPath = fmt.Sprintf("/service_config/%s/%s/service_tags", strings.Split(name, ".")[0], name)
+
+	if err := Manager.Register(reg); err != nil {
+		return nil, err
+	}
+	return &Registration{reg: reg}, nil
+}
+
+// Deregister 注销服务
+func (r *Registration) Deregister() {
+	if r == nil {
+		return
+	}
+	Manager.DeregisterService(r.reg)
+}
+
+func serviceTags(cfg RegisterConfig) map[string]string {
+	tags := make(map[string]string, len(cfg.Tags)+3)
+	for k, v := range cfg.Tags {
+		tags[k] = v
+	}
+	tags["env"] = "online"
+	if len(cfg.Env) > 0 {
+		tags["env"] = cfg.Env
+	}
+	if len(cfg.Version) > 0 {
+		tags["version"] = cfg.Version
+	}
+	if cfg.Weight > 0 {
+		tags[weightTag] = strconv.Itoa(cfg.Weight)
+	}
+	return tags
+}
+
+// checkAddress host为空时使用注册的地址
+func checkAddress(dsn, addr string, port int) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	if len(u.Host) == 0 {
+		u.Host = fmt.Sprintf("%s:%d", addr, port)
+	}
+	return u.String(), nil
+}
+
+func defaultInt(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
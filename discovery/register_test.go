@@ -0,0 +1,206 @@
+package discovery
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/registry"
+)
+
+func TestMain(m *testing.M) {
+	l := logging.New()
+	logging.DefaultKit = logging.NewKit(l, l, l, l, l, l)
+	Manager.SetLogger(l)
+	os.Exit(m.Run())
+}
+
+// fakeBackend 记录注册、注销，kv由测试设置
+type fakeBackend struct {
+	registry.Backend
+	mu           sync.Mutex
+	kv           map[string]string
+	watch        chan string
+	registered   map[string][]string // 服务id对应的tag
+	deregistered []string
+}
+
+func newFakeBackend(t *testing.T) *fakeBackend {
+	b := &fakeBackend{
+		kv:         make(map[string]string),
+		watch:      make(chan string),
+		registered: make(map[string][]string),
+	}
+	old := registry.Default
+	registry.Default = b
+	t.Cleanup(func() {
+		registry.Default = old
+	})
+	return b
+}
+
+func regID(cfg *upstream_config.Register) string {
+	return cfg.ServiceName + "-" + cfg.ServiceAddr
+}
+
+func (b *fakeBackend) Register(cfg *upstream_config.Register) error {
+	tags := <-cfg.TagsOverrideCh
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.registered[regID(cfg)] = tags
+	return nil
+}
+
+func (b *fakeBackend) Deregister(cfg *upstream_config.Register) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deregistered = append(b.deregistered, regID(cfg))
+	return nil
+}
+
+func (b *fakeBackend) ReadManual(path string) (string, uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.kv[path], 0, nil
+}
+
+func (b *fakeBackend) WatchManual(string) chan string {
+	return b.watch
+}
+
+func (b *fakeBackend) tags(id string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.registered[id]
+}
+
+func TestRegisterWithoutRegistry(t *testing.T) {
+	old := registry.Default
+	registry.Default = nil
+	defer func() {
+		registry.Default = old
+	}()
+	if _, err := Register(RegisterConfig{Enable: true}, "test.register", 9000, ""); err != ErrNoRegistry {
+		t.Fatalf("got %v, want ErrNoRegistry", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	b := newFakeBackend(t)
+	b.kv["/service_config/test/test.register/service_tags/10.0.0.1/9000"] = `{"env":"gray","zone":"a"}`
+
+	registration, err := Register(RegisterConfig{
+		Enable:  true,
+		Addr:    "10.0.0.1",
+		Version: "v1.2.0",
+		Weight:  50,
+		Env:     "pre",
+		Tags:    map[string]string{"idc": "bj"},
+	}, "test.register", 9000, "grpc://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registration.Deregister()
+
+	reg := registration.reg
+	if reg.ServiceName != "test.register" || reg.ServiceAddr != "10.0.0.1" || reg.ServicePort != 9000 {
+		t.Fatalf("register %s %s:%d", reg.ServiceName, reg.ServiceAddr, reg.ServicePort)
+	}
+	if reg.ServiceCheckDSN != "grpc://10.0.0.1:9000" {
+		t.Errorf("check dsn %s", reg.ServiceCheckDSN)
+	}
+	if reg.ServiceCheckIntervalMs != defaultCheckInterval || reg.ServiceCheckTimeoutMs != defaultCheckTimeout || reg.DeregisterCriticalServiceAfterSec != defaultDeregisterAfter {
+		t.Errorf("check interval %d, timeout %d, deregister after %d", reg.ServiceCheckIntervalMs, reg.ServiceCheckTimeoutMs, reg.DeregisterCriticalServiceAfterSec)
+	}
+	if reg.TagsWatchPath != "/service_config/test/test.register/service_tags" {
+		t.Errorf("tags watch path %s", reg.TagsWatchPath)
+	}
+
+	// kv中的tag覆盖配置
+	tags := b.tags("test.register-10.0.0.1")
+	sort.Strings(tags)
+	if got := strings.Join(tags, ","); got != "__weight=50,env=gray,idc=bj,version=v1.2.0,zone=a" {
+		t.Errorf("tags %s", got)
+	}
+}
+
+func TestRegisterConfig(t *testing.T) {
+	b := newFakeBackend(t)
+	registration, err := Register(RegisterConfig{
+		Enable:          true,
+		Name:            "test.config_name",
+		Addr:            "10.0.0.2",
+		CheckDSN:        "http://10.0.0.3:8080/health",
+		CheckInterval:   1000,
+		CheckTimeout:    200,
+		DeregisterAfter: 30,
+	}, "test.default_name", 8000, "grpc://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registration.Deregister()
+
+	reg := registration.reg
+	if reg.ServiceName != "test.config_name" {
+		t.Errorf("service name %s", reg.ServiceName)
+	}
+	if reg.ServiceCheckDSN != "http://10.0.0.3:8080/health" {
+		t.Errorf("check dsn %s", reg.ServiceCheckDSN)
+	}
+	if reg.ServiceCheckIntervalMs != 1000 || reg.ServiceCheckTimeoutMs != 200 || reg.DeregisterCriticalServiceAfterSec != 30 {
+		t.Errorf("check interval %d, timeout %d, deregister after %d", reg.ServiceCheckIntervalMs, reg.ServiceCheckTimeoutMs, reg.DeregisterCriticalServiceAfterSec)
+	}
+	if got := strings.Join(b.tags("test.config_name-10.0.0.2"), ","); got != "env=online" {
+		t.Errorf("default tags %s", got)
+	}
+
+	if _, err = Register(RegisterConfig{Enable: true, Addr: "10.0.0.2"}, "", 8000, ""); err == nil {
+		t.Error("register without service name should fail")
+	}
+	if _, err = Register(RegisterConfig{Enable: true, Addr: "10.0.0.2", CheckDSN: "http://%zz"}, "test.bad_dsn", 8000, ""); err == nil {
+		t.Error("register with bad check dsn should fail")
+	}
+}
+
+// reloading 是否有服务tag的reload协程
+func reloading() bool {
+	buf := make([]byte, 1<<20)
+	return strings.Contains(string(buf[:runtime.Stack(buf, true)]), "registry.(*ServiceManager).Register.func")
+}
+
+func TestDeregister(t *testing.T) {
+	b := newFakeBackend(t)
+	registration, err := Register(RegisterConfig{Enable: true, Addr: "10.0.0.4"}, "test.deregister", 7000, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// kv变更后没有读取方，reload协程阻塞在发送tag
+	b.watch <- `{"zone":"b"}`
+	b.watch <- `{"zone":"c"}`
+	if !reloading() {
+		t.Fatal("tag reload goroutine not running")
+	}
+
+	registration.Deregister()
+	registration.Deregister()
+	(*Registration)(nil).Deregister()
+	b.mu.Lock()
+	deregistered := strings.Join(b.deregistered, ",")
+	b.mu.Unlock()
+	if deregistered != "test.deregister-10.0.0.4" {
+		t.Fatalf("deregistered %s", deregistered)
+	}
+	deadline := time.Now().Add(time.Second)
+	for reloading() {
+		if time.Now().After(deadline) {
+			t.Fatal("tag reload goroutine still running after deregister")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,24 +1,28 @@
 package inits
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
 	"sync"
 
+	"google.golang.org/grpc"
 	"gopkg.in/yaml.v3"
 
 	"github.com/lfxnxf/zdy_tools/config"
+	"github.com/lfxnxf/zdy_tools/discovery"
 	"github.com/lfxnxf/zdy_tools/logging"
 	"github.com/lfxnxf/zdy_tools/resource/kafka"
 	"github.com/lfxnxf/zdy_tools/resource/redis"
 	"github.com/lfxnxf/zdy_tools/resource/sql"
-	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/registry"
 	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/upstream"
 	"github.com/lfxnxf/zdy_tools/trace"
+	http_client "github.com/lfxnxf/zdy_tools/zd_http/client"
 	"github.com/lfxnxf/zdy_tools/zd_http/server"
 	rpc_client "github.com/lfxnxf/zdy_tools/zd_rpc/client"
+	rpc_server "github.com/lfxnxf/zdy_tools/zd_rpc/server"
 )
 
 const (
@@ -31,7 +35,7 @@ type Option func(*Default)
 
 var (
 	_default       = new(Default)
-	ServiceManager = registry.NewServiceManager(logging.Log(logging.GenLoggerName))
+	ServiceManager = discovery.Manager
 )
 
 type Default struct {
@@ -99,6 +103,14 @@ func (d *Default) Start(opts ...Option) {
 		// trace
 		d.initTrace()
 
+		// consul
+		if len(d.config.Consul.Addr) > 0 {
+			err := discovery.InitConsul(d.config.Consul)
+			if err != nil {
+				panic(err)
+			}
+		}
+
 		// mysql
 		if len(d.config.Database) > 0 {
 			err := d.initSqlClient(d.config.Database)
@@ -131,11 +143,49 @@ func (d *Default) Start(opts ...Option) {
 			}
 		}
 
+		// rpc service discovery
+		if len(d.config.RpcService) > 0 {
+			err := rpc_client.InitServices(d.config.RpcService)
+			if err != nil {
+				panic(err)
+			}
+		}
+
 		// rpc client
 		if len(d.config.RpcClient) > 0 {
 			d.initRpcClient(d.config.RpcClient)
 		}
 
+		// http client
+		http_client.InitMetrics()
+		if len(d.config.HttpClient) > 0 {
+			for _, c := range d.config.HttpClient {
+				if r, ok := d.redisClients.Load(c.OAuth2.Redis); ok {
+					http_client.RegisterTokenCache(c.OAuth2.Redis, r.(*redis.Redis))
+				}
+			}
+			err := http_client.InitProfiles(d.config.HttpClient)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		// http service discovery
+		if len(d.config.HttpService) > 0 {
+			err := http_client.InitServices(d.config.HttpService)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		// http remote endpoints
+		if len(d.config.Remote) > 0 {
+			err := http_client.InitRemotes(d.config.Remote)
+			if err != nil {
+				panic(err)
+			}
+		}
+
 	})
 }
 
@@ -358,6 +408,13 @@ func NewHttpServer(serverConfig server.HttpServerConfig) *server.HttpServer {
 	return server.NewHttpServer(serverConfig)
 }
 
+// NewRpcServer 创建rpc server，并把mysql和redis的连通性作为就绪检查
+func NewRpcServer(serverConfig rpc_server.RpcServerConfig, register func(server *grpc.Server)) *rpc_server.RpcServer {
+	s := rpc_server.NewRpcServer(serverConfig, register)
+	s.AddReadiness(Ready)
+	return s
+}
+
 func SQLClient(name string) *sql.Group {
 	if client, ok := _default.mysqlClients.Load(name); ok {
 		if v, ok1 := client.(*sql.Group); ok1 {
@@ -388,6 +445,33 @@ func RedisClient(name string) *redis.Redis {
 	return nil
 }
 
+// Ready 检查mysql主库和redis的连通性，NewRpcServer默认使用
+func Ready(ctx context.Context) error {
+	var err error
+	_default.mysqlClients.Range(func(key, value interface{}) bool {
+		db, dbErr := value.(*sql.Group).MasterNoLog().DB.DB()
+		if dbErr == nil {
+			dbErr = db.PingContext(ctx)
+		}
+		if dbErr != nil {
+			err = fmt.Errorf("mysql %v not ready: %w", key, dbErr)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	_default.redisClients.Range(func(key, value interface{}) bool {
+		if !value.(*redis.Redis).Ping(ctx) {
+			err = fmt.Errorf("redis %v not ready", key)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
 func RpcClient(name string) *rpc_client.RpcClient {
 	if client, ok := _default.rpcClients.Load(name); ok {
 		if v, ok1 := client.(*rpc_client.RpcClient); ok1 {
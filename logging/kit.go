@@ -55,3 +55,24 @@ func (c kit) S() *Logger {
 func (c kit) B() *Logger {
 	return c.b
 }
+
+// KitLoggers 按名称返回kit中已初始化的logger
+func KitLoggers(k Kit) map[string]*Logger {
+	loggers := make(map[string]*Logger)
+	if k == nil {
+		return loggers
+	}
+	for name, l := range map[string]*Logger{
+		"access":   k.A(),
+		"error":    k.E(),
+		"info":     k.I(),
+		"debug":    k.D(),
+		"sql":      k.S(),
+		"business": k.B(),
+	} {
+		if l != nil {
+			loggers[name] = l
+		}
+	}
+	return loggers
+}
@@ -354,6 +354,11 @@ func (l *Logger) SetLevelByString(level string) {
 	l.loglevel.SetLevel(stringToLogLevel(level))
 }
 
+// GetLevel 返回当前日志级别，如debug、info
+func (l *Logger) GetLevel() string {
+	return l.loglevel.Level().String()
+}
+
 func (l *Logger) Logger() *log.Logger {
 	stdLogger := log.New(logWriter{
 		logFunc: func() func(msg string, fileds ...interface{}) {
@@ -381,6 +386,19 @@ func SetLevelByString(level string) {
 	_defaultLogger.SetLevelByString(level)
 }
 
+func GetLevel() string {
+	return _defaultLogger.GetLevel()
+}
+
+// ValidLevel 判断是否为SetLevelByString支持的级别
+func ValidLevel(level string) bool {
+	switch level {
+	case "fatal", "error", "warn", "warning", "info", "debug":
+		return true
+	}
+	return false
+}
+
 func SetOutputPath(dir string) {
 	_defaultLogger.SetOutputPath(dir)
 }
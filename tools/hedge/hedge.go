@@ -0,0 +1,206 @@
+package hedge
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDelay         = 100 // milliseconds
+	defaultMaxHedges     = 1
+	defaultBudgetPercent = 10
+
+	// latencyWindow is the number of recent latencies kept for percentile delays.
+	latencyWindow = 1000
+	// minLatencySamples is the number of samples required before the percentile is used.
+	minLatencySamples = 100
+	// budgetDecayAt halves the budget counters so that the budget follows recent traffic.
+	budgetDecayAt = 1000
+)
+
+// Config configures hedged requests.
+type Config struct {
+	Enable bool `yaml:"enable"`
+	// Delay is the time to wait before sending a hedge, in milliseconds.
+	Delay int64 `yaml:"delay"`
+	// Percentile uses the given percentile of recent latencies as the delay, e.g. 95.
+	// Delay is used until enough samples are collected.
+	Percentile float64 `yaml:"percentile"`
+	// MaxHedges is the max number of extra requests, defaults to 1.
+	MaxHedges int `yaml:"max_hedges"`
+	// BudgetPercent caps hedges to the given percent of all requests, defaults to 10.
+	BudgetPercent float64 `yaml:"budget_percent"`
+}
+
+func (c *Config) setDefaults() {
+	if c.Delay <= 0 {
+		c.Delay = defaultDelay
+	}
+	if c.MaxHedges <= 0 {
+		c.MaxHedges = defaultMaxHedges
+	}
+	if c.BudgetPercent <= 0 {
+		c.BudgetPercent = defaultBudgetPercent
+	}
+}
+
+// Policy sends hedged calls and tracks the budget and latencies of one downstream.
+type Policy struct {
+	cfg Config
+
+	mu        sync.Mutex
+	requests  float64
+	hedges    float64
+	latencies []time.Duration
+	next      int
+	samples   int
+	cached    time.Duration
+}
+
+// NewPolicy returns a Policy with cfg.
+func NewPolicy(cfg Config) *Policy {
+	cfg.setDefaults()
+	return &Policy{
+		cfg:       cfg,
+		latencies: make([]time.Duration, latencyWindow),
+	}
+}
+
+// Config returns the config of p.
+func (p *Policy) Config() Config {
+	return p.cfg
+}
+
+// Do calls call, and calls it again with a larger n each time the delay passes
+// without a successful result, as long as the budget allows.
+// The first successful result wins and the contexts of the others are cancelled.
+// If all calls fail, the result and error of the last one are returned.
+func (p *Policy) Do(ctx context.Context, call func(ctx context.Context, n int) (interface{}, error)) (interface{}, error) {
+	type result struct {
+		val   interface{}
+		err   error
+		start time.Time
+	}
+
+	p.addRequest()
+	results := make(chan result, p.cfg.MaxHedges+1)
+	cancels := make([]context.CancelFunc, 0, p.cfg.MaxHedges+1)
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	launch := func(n int) {
+		callCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		start := time.Now()
+		go func() {
+			val, err := call(callCtx, n)
+			results <- result{val: val, err: err, start: start}
+		}()
+	}
+
+	launch(0)
+	inFlight, launched := 1, 1
+	timer := time.NewTimer(p.Delay())
+	defer timer.Stop()
+	var last result
+	for {
+		select {
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				p.observe(time.Since(r.start))
+				return r.val, nil
+			}
+			last = r
+			if inFlight == 0 {
+				return last.val, last.err
+			}
+		case <-timer.C:
+			if launched <= p.cfg.MaxHedges && p.allowHedge() {
+				launch(launched)
+				launched++
+				inFlight++
+				if launched <= p.cfg.MaxHedges {
+					timer.Reset(p.Delay())
+				}
+			}
+		case <-ctx.Done():
+			// wait for the in-flight calls to observe the cancellation
+			for ; inFlight > 0; inFlight-- {
+				last = <-results
+			}
+			return last.val, last.err
+		}
+	}
+}
+
+// Delay returns the current hedging delay.
+func (p *Policy) Delay() time.Duration {
+	delay := time.Duration(p.cfg.Delay) * time.Millisecond
+	if p.cfg.Percentile <= 0 {
+		return delay
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.samples < minLatencySamples {
+		return delay
+	}
+	return p.cached
+}
+
+func (p *Policy) addRequest() {
+	p.mu.Lock()
+	p.requests++
+	if p.requests >= budgetDecayAt {
+		p.requests /= 2
+		p.hedges /= 2
+	}
+	p.mu.Unlock()
+}
+
+// allowHedge reports whether a hedge is within the budget and counts it if so.
+func (p *Policy) allowHedge() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if (p.hedges+1)*100 > p.requests*p.cfg.BudgetPercent {
+		return false
+	}
+	p.hedges++
+	return true
+}
+
+// observe records the latency of a successful call.
+func (p *Policy) observe(d time.Duration) {
+	if p.cfg.Percentile <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latencies[p.next] = d
+	p.next = (p.next + 1) % len(p.latencies)
+	p.samples++
+	// recalculate the percentile every 100 samples to keep observe cheap
+	if p.samples >= minLatencySamples && p.samples%minLatencySamples == 0 {
+		n := p.samples
+		if n > len(p.latencies) {
+			n = len(p.latencies)
+		}
+		sorted := make([]time.Duration, n)
+		copy(sorted, p.latencies[:n])
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		idx := int(float64(n)*p.cfg.Percentile/100+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= n {
+			idx = n - 1
+		}
+		p.cached = sorted[idx]
+	}
+}
@@ -0,0 +1,73 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoHedgeWins(t *testing.T) {
+	p := NewPolicy(Config{Enable: true, Delay: 10, BudgetPercent: 100})
+	var cancelled int32
+	val, err := p.Do(context.Background(), func(ctx context.Context, n int) (interface{}, error) {
+		if n == 0 {
+			select {
+			case <-ctx.Done():
+				atomic.StoreInt32(&cancelled, 1)
+				return n, ctx.Err()
+			case <-time.After(time.Second):
+				return n, nil
+			}
+		}
+		return n, nil
+	})
+	if err != nil || val.(int) != 1 {
+		t.Fatalf("got %v, err %v", val, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Fatal("loser should be cancelled")
+	}
+}
+
+func TestDoBudget(t *testing.T) {
+	p := NewPolicy(Config{Enable: true, Delay: 1, BudgetPercent: 10})
+	var calls int32
+	for i := 0; i < 20; i++ {
+		_, _ = p.Do(context.Background(), func(ctx context.Context, n int) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(5 * time.Millisecond)
+			return n, nil
+		})
+	}
+	if c := atomic.LoadInt32(&calls); c > 22 {
+		t.Fatalf("got %d calls, budget exceeded", c)
+	}
+}
+
+func TestDoAllFail(t *testing.T) {
+	p := NewPolicy(Config{Enable: true, Delay: 1, BudgetPercent: 100})
+	errFail := errors.New("fail")
+	val, err := p.Do(context.Background(), func(ctx context.Context, n int) (interface{}, error) {
+		time.Sleep(5 * time.Millisecond)
+		return n, errFail
+	})
+	if err != errFail || val == nil {
+		t.Fatalf("got %v, err %v", val, err)
+	}
+}
+
+func TestPercentileDelay(t *testing.T) {
+	p := NewPolicy(Config{Enable: true, Delay: 50, Percentile: 90})
+	if p.Delay() != 50*time.Millisecond {
+		t.Fatalf("got %v", p.Delay())
+	}
+	for i := 1; i <= minLatencySamples; i++ {
+		p.observe(time.Duration(i) * time.Millisecond)
+	}
+	if d := p.Delay(); d != 90*time.Millisecond {
+		t.Fatalf("got %v", d)
+	}
+}
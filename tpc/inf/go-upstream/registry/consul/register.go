@@ -49,7 +49,7 @@ func register(logger *logging.Logger, c *api.Client, service *api.AgentServiceRe
 			return
 		}
 
-		logger.Infof("consul: Registered service %s with id %q, address %s, tags %q, http check %q, tcp check %q", service.Name, service.ID, service.Address, strings.Join(service.Tags, ","), service.Check.HTTP, service.Check.TCP)
+		logger.Infof("consul: Registered service %s with id %q, address %s, tags %q, http check %q, tcp check %q, grpc check %q", service.Name, service.ID, service.Address, strings.Join(service.Tags, ","), service.Check.HTTP, service.Check.TCP, service.Check.GRPC)
 		serviceID = service.ID
 	}
 
@@ -95,6 +95,11 @@ func serviceRegistration(cfg *config.Register, tags []string) (*api.AgentService
 		}
 		if checkDSNURL.Scheme == "http" {
 			checker.HTTP = cfg.ServiceCheckDSN
+			checker.TCP = ""
+		} else if checkDSNURL.Scheme == "grpc" {
+			// grpc健康检查，path为检查的服务名，为空时检查整个server
+			checker.GRPC = checkDSNURL.Host + checkDSNURL.Path
+			checker.TCP = ""
 		} else if checkDSNURL.Scheme == "tcp" {
 			checker.TCP = checkDSNURL.Host
 		}
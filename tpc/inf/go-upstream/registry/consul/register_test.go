@@ -0,0 +1,43 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+)
+
+func Test_serviceRegistration(t *testing.T) {
+	tests := []struct {
+		name     string
+		checkDSN string
+		wantTCP  string
+		wantHTTP string
+		wantGRPC string
+	}{
+		{"default-tcp", "", "10.0.0.1:9000", "", ""},
+		{"tcp", "tcp://10.0.0.2:9001", "10.0.0.2:9001", "", ""},
+		{"http", "http://10.0.0.1:9000/health", "", "http://10.0.0.1:9000/health", ""},
+		{"grpc-server", "grpc://10.0.0.1:9000", "", "", "10.0.0.1:9000"},
+		{"grpc-service", "grpc://10.0.0.1:9000/zd.test.Echo", "", "", "10.0.0.1:9000/zd.test.Echo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NewRegister("test.service", "10.0.0.1", 9000)
+			cfg.ServiceCheckDSN = tt.checkDSN
+			service, err := serviceRegistration(cfg, []string{"env=online"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if service.ID != "test.service-10.0.0.1:9000" || service.Name != "test.service" || service.Port != 9000 {
+				t.Errorf("service %s %s %d", service.ID, service.Name, service.Port)
+			}
+			check := service.Check
+			if check.TCP != tt.wantTCP || check.HTTP != tt.wantHTTP || check.GRPC != tt.wantGRPC {
+				t.Errorf("check tcp %q, http %q, grpc %q", check.TCP, check.HTTP, check.GRPC)
+			}
+			if check.Interval != "5000ms" || check.Timeout != "100ms" || check.DeregisterCriticalServiceAfter != "60s" {
+				t.Errorf("check interval %s, timeout %s, deregister after %s", check.Interval, check.Timeout, check.DeregisterCriticalServiceAfter)
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ type ServiceManager struct {
 	logger      *logging.Logger
 	mutex       *sync.Mutex
 	regs        map[string]*config.Register
+	stops       map[string]chan struct{} // 注销时停止tag的watch
 	closed      bool
 	serviceTags []string
 }
@@ -26,6 +27,7 @@ func NewServiceManager(logger *logging.Logger) *ServiceManager {
 		closed: false,
 		logger: logger,
 		regs:   make(map[string]*config.Register),
+		stops:  make(map[string]chan struct{}),
 	}
 }
 
@@ -101,10 +103,22 @@ func (bm *ServiceManager) Register(reg *config.Register) error {
 		return nil
 	}
 	bm.regs[key] = reg
+	stop := make(chan struct{})
+	bm.stops[key] = stop
 	bm.mutex.Unlock()
+	tagsCh := Default.WatchManual(watchPath)
 	var reload = func() {
-		tagsCh := Default.WatchManual(watchPath)
-		for tag := range tagsCh {
+		for {
+			var tag string
+			var ok bool
+			select {
+			case <-stop:
+				return
+			case tag, ok = <-tagsCh:
+				if !ok {
+					return
+				}
+			}
 			if tag == dynamicTagsStr {
 				continue
 			}
@@ -122,7 +136,12 @@ func (bm *ServiceManager) Register(reg *config.Register) error {
 			copy(bm.serviceTags, tagSlice)
 			bm.mutex.Unlock()
 
-			reg.TagsOverrideCh <- tagSlice
+			// 注销后没有读取方，不能阻塞在这里
+			select {
+			case <-stop:
+				return
+			case reg.TagsOverrideCh <- tagSlice:
+			}
 		}
 	}
 	go reload()
@@ -135,10 +154,32 @@ func (bm *ServiceManager) Deregister() {
 		reg := reg
 		Default.Deregister(reg)
 		delete(bm.regs, k)
+		bm.stopWatch(k)
 	}
 	bm.mutex.Unlock()
 }
 
+// DeregisterService 注销单个服务，未注册时忽略
+func (bm *ServiceManager) DeregisterService(reg *config.Register) {
+	key := reg.ServiceName + "-" + reg.ServiceAddr + "-" + strconv.Itoa(reg.ServicePort)
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	if _, ok := bm.regs[key]; !ok {
+		return
+	}
+	Default.Deregister(reg)
+	delete(bm.regs, key)
+	bm.stopWatch(key)
+}
+
+// stopWatch 停止服务tag的reload，需持有mutex
+func (bm *ServiceManager) stopWatch(key string) {
+	if stop, ok := bm.stops[key]; ok {
+		close(stop)
+		delete(bm.stops, key)
+	}
+}
+
 func (bm *ServiceManager) ServiceTags() []string {
 	bm.mutex.Lock()
 	defer bm.mutex.Unlock()
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -32,6 +33,11 @@ type Cluster struct {
 	balancer            atomic.Value
 	hostChangelist      atomic.Value
 	hostChangedCallback atomic.Value
+
+	watchMu     sync.Mutex
+	notifyMu    sync.Mutex
+	watchers    map[int]func([]*Host)
+	nextWatcher int
 }
 
 func NewCluster(conf config.Cluster, backend registry.Backend) *Cluster {
@@ -149,6 +155,50 @@ func (c *Cluster) AddHostChangedCallback(fn func(current []string, added []strin
 	}
 }
 
+// WatchHosts calls fn with the current hosts, then again with all hosts each time the
+// host list changes, until stop is called. Calls to fn are serialized.
+func (c *Cluster) WatchHosts(fn func(hosts []*Host)) (stop func()) {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	c.watchMu.Lock()
+	if c.watchers == nil {
+		c.watchers = make(map[int]func([]*Host))
+	}
+	id := c.nextWatcher
+	c.nextWatcher++
+	c.watchers[id] = fn
+	c.watchMu.Unlock()
+
+	if hosts := c.hostSet.Hosts(); len(hosts) > 0 {
+		fn(copyHosts(hosts))
+	}
+	return func() {
+		c.watchMu.Lock()
+		delete(c.watchers, id)
+		c.watchMu.Unlock()
+	}
+}
+
+func (c *Cluster) notifyWatchers(hosts []*Host) {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	c.watchMu.Lock()
+	fns := make([]func([]*Host), 0, len(c.watchers))
+	for _, fn := range c.watchers {
+		fns = append(fns, fn)
+	}
+	c.watchMu.Unlock()
+	for _, fn := range fns {
+		fn(copyHosts(hosts))
+	}
+}
+
+func copyHosts(hosts []*Host) []*Host {
+	res := make([]*Host, len(hosts))
+	copy(res, hosts)
+	return res
+}
+
 func (c *Cluster) GetHostByAddress(address string) *Host {
 	hostMap := c.hostMap.Load().(map[string]*Host)
 	return hostMap[address]
@@ -225,8 +275,13 @@ func (c *Cluster) loadLastServiceResult() (registry.Cluster, error) {
 	return cluster, err
 }
 
+// WatchServices watch endpoints of the cluster from its registry backend
+func (c *Cluster) WatchServices() chan []*registry.Cluster {
+	return c.registerBackend.WatchServices(c.name, []string{"passing", "warnning"}, c.conf.Datacenter)
+}
+
 func (c *Cluster) listenConfigChange() {
-	ch := c.registerBackend.WatchServices(c.name, []string{"passing", "warnning"}, c.conf.Datacenter)
+	ch := c.WatchServices()
 	var staticEndpoints []string
 	if len(c.conf.StaticEndpoints) != 0 {
 		staticEndpoints = strings.Split(c.conf.StaticEndpoints, ",")
@@ -311,6 +366,7 @@ func (c *Cluster) onClusterChanged(newCluster *registry.Cluster) {
 	changed.added = hostAdded
 	changed.removed = hostRemoved
 	c.hostChangelist.Store(changed)
+	c.notifyWatchers(current)
 }
 
 func (c *Cluster) updateSet(current, added, removed []*Host) {
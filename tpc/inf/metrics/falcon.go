@@ -25,6 +25,7 @@ var (
 	defaultReporter      *reporter
 	successCodeMapMutex  sync.Mutex
 	successCodeMap       *sync.Map
+	tagSuccessCodeMap    = make(map[string]map[int]struct{}) // "tag=value" -> codes
 )
 
 var (
@@ -67,6 +68,25 @@ func AddSuccessCode(cm map[int]int) {
 	}
 }
 
+// AddTagSuccessCode adds success codes that only apply to metrics tagged with tag=value,
+// e.g. http status codes of metrics with clientag=http.
+func AddTagSuccessCode(tag, value string, cm map[int]int) {
+	successCodeMapMutex.Lock()
+	defer successCodeMapMutex.Unlock()
+	key := tag + "=" + value
+	codes, ok := tagSuccessCodeMap[key]
+	if !ok {
+		codes = make(map[int]struct{}, len(cm))
+		tagSuccessCodeMap[key] = codes
+	}
+	for k := range cm {
+		if k == 0 {
+			continue
+		}
+		codes[k] = struct{}{}
+	}
+}
+
 func ReloadSuccessCode(cm map[int]int) {
 	if len(cm) == 0 {
 		return
@@ -709,29 +729,22 @@ func (r *reporter) send() error {
 			realCode0TotalTagsMap[totalTagsString] = true
 		}
 
-		if tagValue, ok := meta.Tags[TagCode]; ok {
-			if code, err := strconv.Atoi(tagValue); err == nil {
-				successCodeMapMutex.Lock()
-				_, load := successCodeMap.Load(code)
-				successCodeMapMutex.Unlock()
-				if load {
-					// 标记success code metric name
-					code0TotalTagsMap[totalTagsString] = true
-
-					// copy tags map
-					tagsNew := make(map[string]string)
-					for k, v := range meta.Tags {
-						if k == TagCode {
-							tagsNew[k] = "0"
-						} else {
-							tagsNew[k] = v
-						}
-					}
-					// 把转化出的值暂存到converted里面
-					convertedCodeTagsString := meta.Name + "|" + mapToString(tagsNew, "")
-					codeConvertMap[convertedCodeTagsString] += ms.Count() - oldCountMap[codeTagsString]
+		if isSuccessCode(meta.Tags) {
+			// 标记success code metric name
+			code0TotalTagsMap[totalTagsString] = true
+
+			// copy tags map
+			tagsNew := make(map[string]string)
+			for k, v := range meta.Tags {
+				if k == TagCode {
+					tagsNew[k] = "0"
+				} else {
+					tagsNew[k] = v
 				}
 			}
+			// 把转化出的值暂存到converted里面
+			convertedCodeTagsString := meta.Name + "|" + mapToString(tagsNew, "")
+			codeConvertMap[convertedCodeTagsString] += ms.Count() - oldCountMap[codeTagsString]
 		}
 	}
 
@@ -837,7 +850,7 @@ func (r *reporter) send() error {
 			})
 		} else {
 			// 如果不存在code=0, 但是存在success code
-			ok1 := isSuccessCode(meta.Tags[TagCode])           // success code
+			ok1 := isSuccessCode(meta.Tags)                    // success code
 			_, ok2 := realCode0TotalTagsMap[totalTagsString]   // 不在code=0的map中，即代表这一组tags不存在code=0
 			_, ok3 := appendSuccessCodeTagMap[totalTagsString] // 并且之前未上报过
 			if ok1 && !ok2 && !ok3 {
@@ -969,11 +982,18 @@ func combineMaps(a, b map[string]string, kvs ...string) string {
 	return combineMapsWithExceptTag(a, b, "", kvs...)
 }
 
-func isSuccessCode(codeVal string) bool {
-	if code, err := strconv.Atoi(codeVal); err == nil {
-		successCodeMapMutex.Lock()
-		defer successCodeMapMutex.Unlock()
-		if _, ok := successCodeMap.Load(code); ok {
+func isSuccessCode(tags map[string]string) bool {
+	code, err := strconv.Atoi(tags[TagCode])
+	if err != nil {
+		return false
+	}
+	successCodeMapMutex.Lock()
+	defer successCodeMapMutex.Unlock()
+	if _, ok := successCodeMap.Load(code); ok {
+		return true
+	}
+	for k, v := range tags {
+		if _, ok := tagSuccessCodeMap[k+"="+v][code]; ok {
 			return true
 		}
 	}
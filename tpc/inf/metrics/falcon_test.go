@@ -256,3 +256,17 @@ func TestSuccessCodeWithoutCode0ToFalcon(t *testing.T) {
 	tm2.Update(47)
 	time.Sleep(2 * time.Second)
 }
+
+func TestTagSuccessCode(t *testing.T) {
+	AddTagSuccessCode("clientag", "http", map[int]int{204: 204})
+
+	if !isSuccessCode(map[string]string{TagCode: "204", "clientag": "http"}) {
+		t.Fatal("204 should be a success code of clientag=http")
+	}
+	if isSuccessCode(map[string]string{TagCode: "204", "clientag": "sql"}) {
+		t.Fatal("204 should not be a success code of clientag=sql")
+	}
+	if isSuccessCode(map[string]string{"clientag": "http"}) {
+		t.Fatal("metrics without code should not be success")
+	}
+}
@@ -17,7 +17,12 @@ var (
 )
 
 // Register register ecode message map.
-func Register(cm map[string]string) {
+// With a locale the messages go to that locale's catalog, otherwise to the default one.
+func Register(cm map[string]string, locale ...string) {
+	if len(locale) > 0 && len(locale[0]) > 0 {
+		registerLocale(normalizeLocale(locale[0]), cm)
+		return
+	}
 	for k, v := range cm {
 		messages.Store(k, v)
 	}
@@ -79,6 +84,15 @@ func (e Code) Message() string {
 	return ret
 }
 
+// MessageIn return error message of the locale
+func (e Code) MessageIn(locale string) string {
+	msg, ok := localeMessage(locale, e.Code())
+	if !ok {
+		return e.Error()
+	}
+	return msg
+}
+
 // Equal for compatible.
 func (e Code) Equal(err error) bool { return EqualError(e, err) }
 
@@ -86,6 +100,7 @@ func (e Code) Equal(err error) bool { return EqualError(e, err) }
 type SpecialError struct {
 	message string
 	code    string
+	details *Details
 }
 
 func AddSpecialError(code string, msg string) SpecialError {
@@ -110,6 +125,20 @@ func (e SpecialError) Message() string {
 // Equal for compatible.
 func (e SpecialError) Equal(err error) bool { return EqualError(e, err) }
 
+// MessageIn return error message, special messages are not localized
+func (e SpecialError) MessageIn(string) string {
+	return e.message
+}
+
+// Details return error details
+func (e SpecialError) Details() *Details { return e.details }
+
+// WithDetails returns a copy of e carrying d.
+func (e SpecialError) WithDetails(d *Details) SpecialError {
+	e.details = d
+	return e
+}
+
 // TopCode returns the first Code object if any code type error
 // in err's chain
 // Otherwise, returns CodeNotFoundErr
@@ -0,0 +1,56 @@
+package zd_error
+
+import (
+	xerrors "errors"
+	"time"
+)
+
+// Details 错误的结构化详情，随响应一起返回给调用方
+type Details struct {
+	InvalidFields []FieldViolation `json:"invalidFields,omitempty"`
+	RetryAfter    int64            `json:"retryAfter,omitempty"` // 建议重试间隔，单位秒
+}
+
+// FieldViolation 校验失败的字段
+type FieldViolation struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// NewDetails 生成错误详情
+func NewDetails() *Details {
+	return &Details{}
+}
+
+// AddInvalidField 添加校验失败的字段
+func (d *Details) AddInvalidField(field, reason string) *Details {
+	d.InvalidFields = append(d.InvalidFields, FieldViolation{
+		Field:  field,
+		Reason: reason,
+	})
+	return d
+}
+
+// SetRetryAfter 设置建议重试间隔
+func (d *Details) SetRetryAfter(after time.Duration) *Details {
+	d.RetryAfter = int64(after / time.Second)
+	return d
+}
+
+// IsEmpty 是否没有任何详情
+func (d *Details) IsEmpty() bool {
+	return d == nil || (len(d.InvalidFields) == 0 && d.RetryAfter == 0)
+}
+
+type detailer interface {
+	Details() *Details
+}
+
+// DetailsOf 返回err链上第一个携带的错误详情
+func DetailsOf(err error) *Details {
+	var d detailer
+	if xerrors.As(err, &d) && !d.Details().IsEmpty() {
+		return d.Details()
+	}
+	return nil
+}
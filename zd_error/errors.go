@@ -1,17 +1,24 @@
 package zd_error
 
+import (
+	"net/http"
+
+	gcodes "google.golang.org/grpc/codes"
+)
+
 var (
 	ParamsErrorCode = "params error"
-	Success         = genError("Success", "success")
-	ServerError     = genError("server error", "内部系统错误")
-	ParamsError     = genError(ParamsErrorCode, "参数错误")
-	SignError       = genError("sign error", "签名错误")
+	Success         = genError("Success", "success", WithHTTPStatus(http.StatusOK), WithGRPCCode(gcodes.OK))
+	ServerError     = genError("server error", "内部系统错误", WithHTTPStatus(http.StatusInternalServerError), WithGRPCCode(gcodes.Internal))
+	ParamsError     = genError(ParamsErrorCode, "参数错误", WithHTTPStatus(http.StatusBadRequest), WithGRPCCode(gcodes.InvalidArgument))
+	SignError       = genError("sign error", "签名错误", WithHTTPStatus(http.StatusUnauthorized), WithGRPCCode(gcodes.Unauthenticated))
 )
 
 // ErrorCode 重定义错误码，以便增加新的支持
 type ErrorCode struct {
-	code Code
-	err  error
+	code    Code
+	err     error
+	details *Details
 }
 
 func (c ErrorCode) Unwrap() error {
@@ -32,20 +39,47 @@ func (c ErrorCode) Message() string {
 	return c.code.Message()
 }
 
+// MessageIn return error message of the locale
+func (c ErrorCode) MessageIn(locale string) string {
+	return c.code.MessageIn(locale)
+}
+
 // Equal for compatible.
 func (c ErrorCode) Equal(err error) bool {
 	return c.code.Equal(err)
 }
 
-func genError(code string, msg string) ErrorCode {
+// HTTPStatus 返回错误码对应的http状态码
+func (c ErrorCode) HTTPStatus() int {
+	return HTTPStatus(c, http.StatusInternalServerError)
+}
+
+// GRPCCode 返回错误码对应的grpc状态码
+func (c ErrorCode) GRPCCode() gcodes.Code {
+	return GRPCCode(c)
+}
+
+// Details 返回错误详情
+func (c ErrorCode) Details() *Details {
+	return c.details
+}
+
+// WithDetails 返回携带错误详情的错误码副本
+func (c ErrorCode) WithDetails(d *Details) ErrorCode {
+	c.details = d
+	return c
+}
+
+func genError(code string, msg string, opts ...Option) ErrorCode {
+	registerStatus(code, opts...)
 	return ErrorCode{
 		code: Error(code, msg),
 	}
 }
 
-// AddError 添加错误码
-func AddError(code string, msg string) ErrorCode {
-	return genError(code, msg)
+// AddError 添加错误码，可通过opts指定对应的http/grpc状态码
+func AddError(code string, msg string, opts ...Option) ErrorCode {
+	return genError(code, msg, opts...)
 }
 
 func DMError(err error) Codes {
@@ -0,0 +1,134 @@
+package zd_error
+
+import (
+	xerrors "errors"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	gcodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// GRPCErrorDomain status details中ErrorInfo的domain，用于识别业务错误码
+const GRPCErrorDomain = "zdy_tools"
+
+const (
+	metaMessage   = "message"
+	metaRequestId = "requestId"
+)
+
+type grpcStatuser interface {
+	GRPCStatus() *status.Status
+}
+
+// GRPCStatus 把错误转换为grpc status
+// 错误码映射为grpc状态码，业务错误码、提示和错误详情放在status details中
+func GRPCStatus(err error) *status.Status {
+	if err == nil {
+		return status.New(gcodes.OK, "")
+	}
+	// 已经是grpc status，如透传的下游错误
+	var gs grpcStatuser
+	if xerrors.As(err, &gs) {
+		return gs.GRPCStatus()
+	}
+	c, cerr := TopCode(err)
+	if cerr != nil {
+		return status.New(gcodes.Unknown, err.Error())
+	}
+	return grpcStatusOf(err, c)
+}
+
+// grpcStatusOf 由错误码生成grpc status，err用于取得requestId和错误详情
+func grpcStatusOf(err error, c Codes) *status.Status {
+	info := &errdetails.ErrorInfo{
+		Reason:   c.Code(),
+		Domain:   GRPCErrorDomain,
+		Metadata: map[string]string{metaMessage: c.Message()},
+	}
+	var remote RemoteError
+	if xerrors.As(err, &remote) && len(remote.RequestId()) > 0 {
+		info.Metadata[metaRequestId] = remote.RequestId()
+	}
+	details := []protoiface.MessageV1{info}
+	if d := DetailsOf(err); d != nil {
+		if len(d.InvalidFields) > 0 {
+			br := &errdetails.BadRequest{}
+			for _, f := range d.InvalidFields {
+				br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+					Field:       f.Field,
+					Description: f.Reason,
+				})
+			}
+			details = append(details, br)
+		}
+		if d.RetryAfter > 0 {
+			details = append(details, &errdetails.RetryInfo{
+				RetryDelay: durationpb.New(time.Duration(d.RetryAfter) * time.Second),
+			})
+		}
+	}
+
+	code := GRPCCode(c)
+	if code == gcodes.OK {
+		code = gcodes.Unknown
+	}
+	st := status.New(code, c.Message())
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// FromGRPCStatus 把grpc status还原为错误
+// 携带业务错误码时返回RemoteError，zd_error.EqualError可跨服务比较错误码，否则返回status的错误
+func FromGRPCStatus(s *status.Status) error {
+	if s == nil || s.Code() == gcodes.OK {
+		return nil
+	}
+	var (
+		info    *errdetails.ErrorInfo
+		details *Details
+	)
+	for _, d := range s.Details() {
+		switch v := d.(type) {
+		case *errdetails.ErrorInfo:
+			if v.GetDomain() == GRPCErrorDomain {
+				info = v
+			}
+		case *errdetails.BadRequest:
+			if details == nil {
+				details = NewDetails()
+			}
+			for _, f := range v.GetFieldViolations() {
+				details.AddInvalidField(f.GetField(), f.GetDescription())
+			}
+		case *errdetails.RetryInfo:
+			if details == nil {
+				details = NewDetails()
+			}
+			details.SetRetryAfter(v.GetRetryDelay().AsDuration())
+		}
+	}
+	if info == nil {
+		return s.Err()
+	}
+	meta := info.GetMetadata()
+	return NewRemoteError(info.GetReason(), meta[metaMessage], meta[metaRequestId]).
+		WithDetails(details).
+		WithGRPCStatus(s)
+}
+
+// FromGRPCError 把grpc调用返回的错误还原为业务错误，非grpc status的错误原样返回
+func FromGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return FromGRPCStatus(s)
+}
@@ -0,0 +1,80 @@
+package zd_error
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	gcodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCStatus(t *testing.T) {
+	notFound := AddError("test grpc not found", "not found", WithGRPCCode(gcodes.NotFound))
+	details := NewDetails().AddInvalidField("name", "required").SetRetryAfter(3 * time.Second)
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode gcodes.Code
+		wantErr  Codes
+	}{
+		{"params", ParamsError.WithDetails(details), gcodes.InvalidArgument, ParamsError},
+		{"wrapped", fmt.Errorf("get tenant: %w", notFound), gcodes.NotFound, notFound},
+		{"special", AddSpecialError("test grpc special", "custom message"), gcodes.Unknown, String("test grpc special")},
+		{"remote", NewRemoteError("test grpc remote", "remote message", "req-1"), gcodes.Unknown, String("test grpc remote")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := GRPCStatus(tt.err)
+			if st.Code() != tt.wantCode {
+				t.Errorf("GRPCStatus().Code() = %v, want %v", st.Code(), tt.wantCode)
+			}
+			// 经过传输后还原
+			err := FromGRPCError(status.FromProto(st.Proto()).Err())
+			if !EqualError(tt.wantErr, err) {
+				t.Errorf("FromGRPCError() = %v, want code %s", err, tt.wantErr.Code())
+			}
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("status.Code() = %v, want %v", status.Code(err), tt.wantCode)
+			}
+			want, _ := TopCode(tt.err)
+			if c, _ := TopCode(err); c.Message() != want.Message() {
+				t.Errorf("Message() = %q, want %q", c.Message(), want.Message())
+			}
+		})
+	}
+
+	err := FromGRPCError(GRPCStatus(ParamsError.WithDetails(details)).Err())
+	d := DetailsOf(err)
+	if d == nil || len(d.InvalidFields) != 1 || d.InvalidFields[0].Field != "name" || d.RetryAfter != 3 {
+		t.Errorf("DetailsOf() = %+v", d)
+	}
+	var remote RemoteError
+	if err = FromGRPCError(GRPCStatus(NewRemoteError("c", "m", "req-1")).Err()); !errors.As(err, &remote) || remote.RequestId() != "req-1" {
+		t.Errorf("FromGRPCError() = %v, want requestId", err)
+	}
+}
+
+func TestFromGRPCError(t *testing.T) {
+	if err := FromGRPCError(nil); err != nil {
+		t.Errorf("FromGRPCError(nil) = %v", err)
+	}
+	plain := errors.New("plain")
+	if err := FromGRPCError(plain); err != plain {
+		t.Errorf("FromGRPCError() = %v, want plain error", err)
+	}
+	// 没有业务错误码的status原样返回
+	err := FromGRPCError(status.Error(gcodes.Unavailable, "connection refused"))
+	if status.Code(err) != gcodes.Unavailable {
+		t.Errorf("status.Code() = %v, want Unavailable", status.Code(err))
+	}
+	if _, cerr := TopCode(err); cerr == nil {
+		t.Errorf("TopCode() should not find a code")
+	}
+	// 来自http的下游错误也能转换为grpc status
+	if st := GRPCStatus(NewRemoteError(ParamsErrorCode, "bad", "")); st.Code() != gcodes.InvalidArgument {
+		t.Errorf("GRPCStatus().Code() = %v, want InvalidArgument", st.Code())
+	}
+}
@@ -0,0 +1,206 @@
+package zd_error
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// localeKey 上下文中的语言标识key
+type localeKey struct{}
+
+const (
+	// ParamsErrorFormat 参数错误提示的格式，作为消息key注册到各语言目录中
+	ParamsErrorFormat = "params error format"
+)
+
+var (
+	defaultLocale  atomic.Value // string
+	localeMessages sync.Map     // map[string]*sync.Map
+)
+
+func init() {
+	defaultLocale.Store("zh")
+	Register(map[string]string{
+		ParamsErrorFormat: "参数错误，%s",
+	})
+	Register(map[string]string{
+		Success.Code():     "success",
+		ServerError.Code(): "internal server error",
+		ParamsError.Code(): "invalid params",
+		SignError.Code():   "invalid sign",
+		ParamsErrorFormat:  "invalid params, %s",
+	}, "en")
+}
+
+// SetDefaultLocale 设置默认语言，默认语言的消息即不带语言注册的消息
+func SetDefaultLocale(locale string) {
+	defaultLocale.Store(normalizeLocale(locale))
+}
+
+// DefaultLocale 返回默认语言
+func DefaultLocale() string {
+	return defaultLocale.Load().(string)
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func registerLocale(locale string, cm map[string]string) {
+	v, _ := localeMessages.LoadOrStore(locale, new(sync.Map))
+	catalog := v.(*sync.Map)
+	for k, msg := range cm {
+		catalog.Store(k, msg)
+	}
+}
+
+func lookupLocale(locale, key string) (string, bool) {
+	if len(locale) == 0 {
+		return "", false
+	}
+	v, ok := localeMessages.Load(locale)
+	if !ok {
+		return "", false
+	}
+	msg, ok := v.(*sync.Map).Load(key)
+	if !ok {
+		return "", false
+	}
+	return msg.(string), true
+}
+
+// localeMessage 依次查找locale、locale的主语言、默认语言、默认消息
+// 默认语言也可能注册了目录，如SetDefaultLocale("en")后未知语言也使用en目录
+func localeMessage(locale, key string) (string, bool) {
+	locale = normalizeLocale(locale)
+	if msg, ok := lookupLocale(locale, key); ok {
+		return msg, true
+	}
+	if i := strings.IndexByte(locale, '-'); i > 0 {
+		if msg, ok := lookupLocale(locale[:i], key); ok {
+			return msg, true
+		}
+	}
+	if msg, ok := lookupLocale(DefaultLocale(), key); ok {
+		return msg, true
+	}
+	v, ok := messages.Load(key)
+	if !ok {
+		return "", false
+	}
+	msg, _ := v.(string)
+	return msg, true
+}
+
+type localizer interface {
+	MessageIn(locale string) string
+}
+
+// LocalizedMessage 返回错误码在locale下的消息，不存在时回退到默认消息
+func LocalizedMessage(c Codes, locale string) string {
+	if l, ok := c.(localizer); ok {
+		return l.MessageIn(locale)
+	}
+	return c.Message()
+}
+
+// ParamsErrorMessage 返回locale下带原因的参数错误消息
+func ParamsErrorMessage(locale, reason string) string {
+	format, ok := localeMessage(locale, ParamsErrorFormat)
+	if !ok {
+		format = "%s"
+	}
+	return fmt.Sprintf(format, reason)
+}
+
+// LoadCatalog 从yaml或json文件加载多语言消息目录，文件格式为 locale -> code -> message
+func LoadCatalog(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	catalogs := make(map[string]map[string]string)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &catalogs)
+	case ".json":
+		err = json.Unmarshal(b, &catalogs)
+	default:
+		return fmt.Errorf("zd_error: unsupported catalog file %s", path)
+	}
+	if err != nil {
+		return err
+	}
+	for locale, cm := range catalogs {
+		Register(cm, locale)
+	}
+	return nil
+}
+
+// WithLocale 将语言标识写入上下文，http请求写入Request的context
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext 读取上下文中的语言标识
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	return locale
+}
+
+// MatchAcceptLanguage 按q值从Accept-Language中选出第一个已注册的语言，没有时返回默认语言
+func MatchAcceptLanguage(header string) string {
+	type tag struct {
+		locale string
+		q      float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := normalizeLocale(fields[0])
+		if len(locale) == 0 || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		tags = append(tags, tag{locale, q})
+	}
+	defLocale := DefaultLocale()
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	for _, t := range tags {
+		if t.locale == defLocale {
+			return defLocale
+		}
+		if _, ok := localeMessages.Load(t.locale); ok {
+			return t.locale
+		}
+		if i := strings.IndexByte(t.locale, '-'); i > 0 {
+			if t.locale[:i] == defLocale {
+				return defLocale
+			}
+			if _, ok := localeMessages.Load(t.locale[:i]); ok {
+				return t.locale[:i]
+			}
+		}
+	}
+	return defLocale
+}
@@ -0,0 +1,110 @@
+package zd_error
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"empty", "", "zh"},
+		{"exact", "en", "en"},
+		{"region", "en-US,en;q=0.9", "en"},
+		{"quality", "fr;q=0.8,en;q=0.9", "en"},
+		{"default region", "zh-CN,en;q=0.5", "zh"},
+		{"unknown", "fr,de", "zh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchAcceptLanguage(tt.header); got != tt.want {
+				t.Errorf("MatchAcceptLanguage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	code := AddError("test locale", "本地化错误")
+	dir, err := ioutil.TempDir("", "zd_error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "messages.yaml")
+	content := "en:\n  test locale: localized error\nja:\n  test locale: ローカライズエラー\n"
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = LoadCatalog(path); err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"en", "localized error"},
+		{"en-GB", "localized error"},
+		{"ja", "ローカライズエラー"},
+		{"fr", "本地化错误"},
+		{"", "本地化错误"},
+	}
+	for _, tt := range tests {
+		if got := LocalizedMessage(code, tt.locale); got != tt.want {
+			t.Errorf("LocalizedMessage(%q) = %v, want %v", tt.locale, got, tt.want)
+		}
+	}
+	if got := ParamsErrorMessage("en", "name required"); got != "invalid params, name required" {
+		t.Errorf("ParamsErrorMessage() = %v", got)
+	}
+}
+
+func TestSetDefaultLocale(t *testing.T) {
+	code := AddError("test default locale", "默认语言错误")
+	Register(map[string]string{code.Code(): "default locale error"}, "en")
+
+	SetDefaultLocale("en")
+	defer SetDefaultLocale("zh")
+
+	if got := DefaultLocale(); got != "en" {
+		t.Fatalf("DefaultLocale() = %v, want en", got)
+	}
+	// 默认语言的目录仍然优先于不带语言注册的消息
+	if got := LocalizedMessage(code, "en"); got != "default locale error" {
+		t.Errorf("LocalizedMessage(en) = %v, want default locale error", got)
+	}
+	// 空语言和未知语言使用默认语言的目录，与MatchAcceptLanguage一致
+	for _, locale := range []string{"", "fr"} {
+		if got := LocalizedMessage(code, locale); got != "default locale error" {
+			t.Errorf("LocalizedMessage(%q) = %v, want default locale error", locale, got)
+		}
+	}
+	// 默认语言没有注册的消息使用默认消息
+	other := AddError("test default locale missing", "默认语言缺失")
+	if got := LocalizedMessage(other, "fr"); got != "默认语言缺失" {
+		t.Errorf("LocalizedMessage() = %v, want 默认语言缺失", got)
+	}
+	if got := MatchAcceptLanguage("fr"); got != "en" {
+		t.Errorf("MatchAcceptLanguage() = %v, want en", got)
+	}
+}
+
+func TestLocaleContext(t *testing.T) {
+	ctx := WithLocale(context.Background(), "en")
+	if got := LocaleFromContext(ctx); got != "en" {
+		t.Errorf("LocaleFromContext() = %v, want en", got)
+	}
+	// 同名的字符串key不会冲突
+	ctx = context.WithValue(context.Background(), "locale", "ja")
+	if got := LocaleFromContext(ctx); got != "" {
+		t.Errorf("LocaleFromContext() = %v, want empty", got)
+	}
+}
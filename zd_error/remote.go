@@ -0,0 +1,81 @@
+package zd_error
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/status"
+)
+
+// RemoteError 下游服务返回的业务错误，保留下游的错误码、提示和requestId
+type RemoteError struct {
+	code       string
+	message    string
+	requestId  string
+	httpStatus int
+	grpcStatus *status.Status
+	details    *Details
+}
+
+// NewRemoteError 由下游响应生成错误
+func NewRemoteError(code, msg, requestId string) RemoteError {
+	return RemoteError{
+		code:      code,
+		message:   msg,
+		requestId: requestId,
+	}
+}
+
+func (e RemoteError) Error() string {
+	if len(e.requestId) == 0 {
+		return fmt.Sprintf("remote error: code=%s, message=%s", e.code, e.message)
+	}
+	return fmt.Sprintf("remote error: code=%s, message=%s, requestId=%s", e.code, e.message, e.requestId)
+}
+
+// Code return error code
+func (e RemoteError) Code() string { return e.code }
+
+// Message return error message
+func (e RemoteError) Message() string { return e.message }
+
+// MessageIn return error message, remote messages are not localized
+func (e RemoteError) MessageIn(string) string { return e.message }
+
+// Equal for compatible.
+func (e RemoteError) Equal(err error) bool { return EqualError(e, err) }
+
+// RequestId 下游的requestId，用于跨服务排查
+func (e RemoteError) RequestId() string { return e.requestId }
+
+// RemoteHTTPStatus 下游响应的http状态码
+func (e RemoteError) RemoteHTTPStatus() int { return e.httpStatus }
+
+// WithHTTPStatus 返回记录了下游http状态码的副本
+func (e RemoteError) WithHTTPStatus(status int) RemoteError {
+	e.httpStatus = status
+	return e
+}
+
+// Details return error details
+func (e RemoteError) Details() *Details { return e.details }
+
+// WithDetails returns a copy of e carrying d.
+func (e RemoteError) WithDetails(d *Details) RemoteError {
+	e.details = d
+	return e
+}
+
+// GRPCStatus 下游返回的grpc status，status.FromError据此取得原始状态码
+// 来自http等其他协议时按错误码生成
+func (e RemoteError) GRPCStatus() *status.Status {
+	if e.grpcStatus != nil {
+		return e.grpcStatus
+	}
+	return grpcStatusOf(e, e)
+}
+
+// WithGRPCStatus 返回记录了下游grpc status的副本
+func (e RemoteError) WithGRPCStatus(s *status.Status) RemoteError {
+	e.grpcStatus = s
+	return e
+}
@@ -0,0 +1,143 @@
+package zd_error
+
+import (
+	"net/http"
+	"sync"
+
+	gcodes "google.golang.org/grpc/codes"
+)
+
+var (
+	statuses sync.Map // map[string]codeStatus
+)
+
+// codeStatus 错误码对应的传输层状态
+type codeStatus struct {
+	httpStatus int
+	grpcCode   gcodes.Code
+	hasGRPC    bool
+}
+
+// Option 注册错误码时的可选项
+type Option func(*codeStatus)
+
+// WithHTTPStatus 设置错误码对应的http状态码
+func WithHTTPStatus(status int) Option {
+	return func(s *codeStatus) {
+		s.httpStatus = status
+	}
+}
+
+// WithGRPCCode 设置错误码对应的grpc状态码
+func WithGRPCCode(code gcodes.Code) Option {
+	return func(s *codeStatus) {
+		s.grpcCode = code
+		s.hasGRPC = true
+	}
+}
+
+func registerStatus(code string, opts ...Option) {
+	if len(opts) == 0 {
+		return
+	}
+	var s codeStatus
+	if v, ok := statuses.Load(code); ok {
+		s = v.(codeStatus)
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	statuses.Store(code, s)
+}
+
+func loadStatus(code string) codeStatus {
+	v, ok := statuses.Load(code)
+	if !ok {
+		return codeStatus{}
+	}
+	return v.(codeStatus)
+}
+
+// HTTPStatus 返回err对应的http状态码
+// 优先使用注册的http状态码，其次由grpc状态码推导，都未注册时返回def
+func HTTPStatus(err error, def int) int {
+	s := loadStatus(Cause(err).Code())
+	switch {
+	case s.httpStatus != 0:
+		return s.httpStatus
+	case s.hasGRPC:
+		return httpStatusFromGRPC(s.grpcCode)
+	}
+	return def
+}
+
+// GRPCCode 返回err对应的grpc状态码
+// 优先使用注册的grpc状态码，其次由http状态码推导，都未注册时返回codes.Unknown
+func GRPCCode(err error) gcodes.Code {
+	if err == nil {
+		return gcodes.OK
+	}
+	s := loadStatus(Cause(err).Code())
+	switch {
+	case s.hasGRPC:
+		return s.grpcCode
+	case s.httpStatus != 0:
+		return grpcCodeFromHTTP(s.httpStatus)
+	}
+	return gcodes.Unknown
+}
+
+func httpStatusFromGRPC(code gcodes.Code) int {
+	switch code {
+	case gcodes.OK:
+		return http.StatusOK
+	case gcodes.InvalidArgument, gcodes.OutOfRange, gcodes.FailedPrecondition:
+		return http.StatusBadRequest
+	case gcodes.Unauthenticated:
+		return http.StatusUnauthorized
+	case gcodes.PermissionDenied:
+		return http.StatusForbidden
+	case gcodes.NotFound:
+		return http.StatusNotFound
+	case gcodes.AlreadyExists, gcodes.Aborted:
+		return http.StatusConflict
+	case gcodes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case gcodes.Unimplemented:
+		return http.StatusNotImplemented
+	case gcodes.Unavailable:
+		return http.StatusServiceUnavailable
+	case gcodes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func grpcCodeFromHTTP(status int) gcodes.Code {
+	switch status {
+	case http.StatusOK:
+		return gcodes.OK
+	case http.StatusBadRequest:
+		return gcodes.InvalidArgument
+	case http.StatusUnauthorized:
+		return gcodes.Unauthenticated
+	case http.StatusForbidden:
+		return gcodes.PermissionDenied
+	case http.StatusNotFound:
+		return gcodes.NotFound
+	case http.StatusConflict:
+		return gcodes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return gcodes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return gcodes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return gcodes.Unavailable
+	case http.StatusGatewayTimeout:
+		return gcodes.DeadlineExceeded
+	}
+	if status >= 400 && status < 500 {
+		return gcodes.FailedPrecondition
+	}
+	return gcodes.Internal
+}
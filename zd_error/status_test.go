@@ -0,0 +1,53 @@
+package zd_error
+
+import (
+	"net/http"
+	"testing"
+
+	gcodes "google.golang.org/grpc/codes"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	notFound := AddError("test not found", "not found", WithGRPCCode(gcodes.NotFound))
+	conflict := AddError("test conflict", "conflict", WithHTTPStatus(http.StatusConflict))
+	plain := AddError("test plain", "plain")
+
+	tests := []struct {
+		name     string
+		err      error
+		def      int
+		wantHTTP int
+		wantGRPC gcodes.Code
+	}{
+		{"nil", nil, http.StatusTeapot, http.StatusOK, gcodes.OK},
+		{"params", ParamsError, http.StatusOK, http.StatusBadRequest, gcodes.InvalidArgument},
+		{"special params", AddSpecialError(ParamsErrorCode, "custom"), http.StatusOK, http.StatusBadRequest, gcodes.InvalidArgument},
+		{"grpc only", notFound, http.StatusOK, http.StatusNotFound, gcodes.NotFound},
+		{"http only", conflict, http.StatusOK, http.StatusConflict, gcodes.AlreadyExists},
+		{"unregistered", plain, http.StatusOK, http.StatusOK, gcodes.Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTTPStatus(tt.err, tt.def); got != tt.wantHTTP {
+				t.Errorf("HTTPStatus() = %v, want %v", got, tt.wantHTTP)
+			}
+			if got := GRPCCode(tt.err); got != tt.wantGRPC {
+				t.Errorf("GRPCCode() = %v, want %v", got, tt.wantGRPC)
+			}
+		})
+	}
+}
+
+func TestDetailsOf(t *testing.T) {
+	if d := DetailsOf(ParamsError); d != nil {
+		t.Errorf("DetailsOf() = %v, want nil", d)
+	}
+	err := ParamsError.WithDetails(NewDetails().AddInvalidField("name", "required"))
+	d := DetailsOf(err)
+	if d == nil || len(d.InvalidFields) != 1 || d.InvalidFields[0].Field != "name" {
+		t.Errorf("DetailsOf() = %v, want invalid field name", d)
+	}
+	if !EqualError(ParamsError, err) {
+		t.Errorf("EqualError() = false, want true")
+	}
+}
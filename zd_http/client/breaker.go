@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/circuit"
+)
+
+const (
+	breakerNamePrefix = "http_client."
+
+	defaultBreakerMinSamples = 20
+)
+
+// errServerError 服务不可用的响应计为熔断失败
+var errServerError = errors.New("http client server error")
+
+// defaultFailureCodes 默认计为失败的状态码，业务错误码对应的500不计入
+var defaultFailureCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// BreakerConfig 熔断配置，按服务名熔断，未使用服务发现时按url的host熔断
+type BreakerConfig struct {
+	Enable           bool  `yaml:"enable"`
+	PerHost          bool  `yaml:"per_host"`          // 服务发现时按节点熔断
+	ErrorPercent     int64 `yaml:"error_percent"`     // 错误率阈值，如50表示50%，0不启用
+	MinSamples       int64 `yaml:"min_samples"`       // 计算错误率的最少请求数
+	ConsecutiveError int64 `yaml:"consecutive_error"` // 连续错误次数阈值，0不启用
+	AverageRT        int64 `yaml:"average_rt"`        // 平均响应时间阈值，单位毫秒，0不启用
+	FailureCodes     []int `yaml:"failure_codes"`     // 计为失败的状态码，默认502、503、504，请求错误和超时总是计为失败
+}
+
+// isFailure 响应状态码是否计为熔断失败
+func (cfg BreakerConfig) isFailure(statusCode int) bool {
+	if len(cfg.FailureCodes) == 0 {
+		return containsCode(defaultFailureCodes, statusCode)
+	}
+	return containsCode(cfg.FailureCodes, statusCode)
+}
+
+func containsCode(codes []int, statusCode int) bool {
+	for _, code := range codes {
+		if statusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// breakerSettings 注册到circuit的阈值
+type breakerSettings struct {
+	errorPercent     int64
+	minSamples       int64
+	consecutiveError int64
+	averageRT        int64
+}
+
+func (cfg BreakerConfig) settings() breakerSettings {
+	minSamples := cfg.MinSamples
+	if minSamples <= 0 {
+		minSamples = defaultBreakerMinSamples
+	}
+	return breakerSettings{
+		errorPercent:     cfg.ErrorPercent,
+		minSamples:       minSamples,
+		consecutiveError: cfg.ConsecutiveError,
+		averageRT:        cfg.AverageRT,
+	}
+}
+
+// Fallback 请求失败(包括被熔断)时调用，返回的数据作为响应body
+type Fallback func(ctx context.Context, err error) ([]byte, error)
+
+type breakerEntry struct {
+	cb       *circuit.Breaker
+	settings breakerSettings
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*breakerEntry)
+)
+
+// getBreaker 同一名称共用一个熔断器，配置变化时更新阈值，以最后一次请求的配置为准
+func getBreaker(name string, cfg BreakerConfig) *circuit.Breaker {
+	settings := cfg.settings()
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	e, ok := breakers[name]
+	if ok && e.settings == settings {
+		return e.cb
+	}
+	circuit.SettingErrorPercent(name, settings.errorPercent > 0, settings.errorPercent, settings.minSamples)
+	circuit.SettingConsecutiveError(name, settings.consecutiveError > 0, settings.consecutiveError)
+	circuit.SettingAverageRT(name, settings.averageRT > 0, ms(settings.averageRT))
+	if !ok {
+		e = &breakerEntry{cb: circuit.NewBreakerWithOptions(&circuit.Options{Name: name})}
+		breakers[name] = e
+		circuit.AddBreaker(name, e.cb)
+	}
+	e.settings = settings
+	return e.cb
+}
+
+// breakerName 熔断粒度，服务名或host
+func (c *client) breakerName(reqURL, address string, cfg BreakerConfig) string {
+	if len(c.service) > 0 {
+		if cfg.PerHost && len(address) > 0 {
+			return breakerNamePrefix + c.service + "." + address
+		}
+		return breakerNamePrefix + c.service
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return breakerNamePrefix + reqURL
+	}
+	return breakerNamePrefix + u.Host
+}
+
+// withBreaker 在熔断器中执行请求，熔断打开时直接返回circuit.BreakerError
+func (c *client) withBreaker(cfg BreakerConfig, reqURL, address string, call func() (int, error)) (int, error) {
+	if !cfg.Enable {
+		return call()
+	}
+	cb := getBreaker(c.breakerName(reqURL, address, cfg), cfg)
+	var statusCode int
+	var callErr error
+	err := cb.Call(func() error {
+		statusCode, callErr = call()
+		// 主动取消的请求(如对冲请求中失败的一方)不计入失败
+		if errors.Is(callErr, context.Canceled) {
+			return nil
+		}
+		if callErr != nil {
+			return callErr
+		}
+		if cfg.isFailure(statusCode) {
+			return errServerError
+		}
+		return nil
+	})
+	if err == errServerError {
+		return statusCode, nil
+	}
+	if callErr == nil && err != nil {
+		// 请求未发出，被熔断或限流
+		return 0, err
+	}
+	return statusCode, callErr
+}
+
+// IsBreakerError 判断是否为熔断导致的快速失败
+func IsBreakerError(err error) bool {
+	var be circuit.BreakerError
+	return errors.As(err, &be) && be.Breaker()
+}
+
+// runFallback 最终请求失败时执行降级函数，熔断计为失败的状态码同样降级
+func (c *client) runFallback(ctx context.Context, cfg BreakerConfig) {
+	if c.fallback == nil {
+		return
+	}
+	origin := c.err
+	if origin == nil {
+		if !cfg.isFailure(c.statusCode) {
+			return
+		}
+		origin = fmt.Errorf("%w: %s", errServerError, c.status)
+	}
+	body, err := c.fallback(ctx, origin)
+	if err != nil {
+		c.err = fmt.Errorf("fallback failed: %w, origin error: %v", err, origin)
+		return
+	}
+	c.err = nil
+	c.respBody = body
+	c.statusCode = http.StatusOK
+	c.status = "200 OK"
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/upstream"
+)
+
+func TestBreaker(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := BreakerConfig{Enable: true, ConsecutiveError: 2}
+	for i := 0; i < 2; i++ {
+		if err := NewReq(context.Background()).WithBreaker(cfg).Get(srv.URL).Response().ParseEmpty(); err == nil || IsBreakerError(err) {
+			t.Fatalf("attempt %d got %v", i, err)
+		}
+	}
+
+	err := NewReq(context.Background()).WithBreaker(cfg).Get(srv.URL).Response().ParseEmpty()
+	if !IsBreakerError(err) {
+		t.Fatalf("expected breaker error, got %v", err)
+	}
+	if atomic.LoadInt64(&hits) != 2 {
+		t.Fatalf("server hit %d times", hits)
+	}
+
+	var resp string
+	err = NewReq(context.Background()).WithBreaker(cfg).WithFallback(func(ctx context.Context, err error) ([]byte, error) {
+		return []byte("fallback"), nil
+	}).Get(srv.URL).Response().ParseString(&resp)
+	if err != nil || resp != "fallback" {
+		t.Fatalf("got %q, %v", resp, err)
+	}
+}
+
+func TestBreakerFallbackStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// 熔断未打开时，计为失败的状态码也执行降级
+	var origin error
+	var resp string
+	err := NewReq(context.Background()).WithBreaker(BreakerConfig{Enable: true}).WithFallback(func(ctx context.Context, err error) ([]byte, error) {
+		origin = err
+		return []byte("fallback"), nil
+	}).Get(srv.URL).Response().ParseString(&resp)
+	if err != nil || resp != "fallback" {
+		t.Fatalf("got %q, %v", resp, err)
+	}
+	if !errors.Is(origin, errServerError) {
+		t.Fatalf("fallback got %v", origin)
+	}
+}
+
+func TestBreakerFailureCodes(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		// WriteJson返回业务错误码时状态码为500
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := BreakerConfig{Enable: true, ConsecutiveError: 2}
+	for i := 0; i < 5; i++ {
+		if err := NewReq(context.Background()).WithBreaker(cfg).Get(srv.URL).Response().ParseEmpty(); IsBreakerError(err) {
+			t.Fatalf("attempt %d: 500 should not trip the breaker", i)
+		}
+	}
+
+	// 配置的失败状态码
+	cfg.FailureCodes = []int{http.StatusInternalServerError}
+	for i := 0; i < 2; i++ {
+		_ = NewReq(context.Background()).WithBreaker(cfg).Get(srv.URL).Response().ParseEmpty()
+	}
+	if err := NewReq(context.Background()).WithBreaker(cfg).Get(srv.URL).Response().ParseEmpty(); !IsBreakerError(err) {
+		t.Fatalf("expected breaker error with failure codes, got %v", err)
+	}
+	if n := atomic.LoadInt64(&hits); n != 7 {
+		t.Fatalf("server hit %d times", n)
+	}
+}
+
+func TestBreakerConfigChange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	// 第一次使用的配置不会熔断
+	_ = NewReq(context.Background()).WithBreaker(BreakerConfig{Enable: true}).Get(srv.URL).Response().ParseEmpty()
+
+	cfg := BreakerConfig{Enable: true, ConsecutiveError: 1}
+	_ = NewReq(context.Background()).WithBreaker(cfg).Get(srv.URL).Response().ParseEmpty()
+	if err := NewReq(context.Background()).WithBreaker(cfg).Get(srv.URL).Response().ParseEmpty(); !IsBreakerError(err) {
+		t.Fatalf("later WithBreaker config should apply, got %v", err)
+	}
+}
+
+func TestResultOf(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	tests := []struct {
+		statusCode int
+		err        error
+		want       upstream.Result
+	}{
+		{http.StatusOK, nil, resultSuccess},
+		{http.StatusInternalServerError, nil, resultSuccess},
+		{http.StatusServiceUnavailable, nil, resultRequestError},
+		{0, context.DeadlineExceeded, resultRequestError},
+		{0, dialErr, resultConnectError},
+	}
+	for _, tt := range tests {
+		if got := resultOf(tt.statusCode, tt.err); got != tt.want {
+			t.Errorf("resultOf(%d, %v) = %v, want %v", tt.statusCode, tt.err, got, tt.want)
+		}
+	}
+}
@@ -6,17 +6,19 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/cenk/backoff"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/lfxnxf/zdy_tools/logging"
+	"github.com/lfxnxf/zdy_tools/tools/hedge"
 	"github.com/lfxnxf/zdy_tools/trace"
 	"github.com/lfxnxf/zdy_tools/utils"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"io"
 	"io/ioutil"
 	"math"
-	"net"
 	"net/http"
-	"strings"
+	"net/url"
 	"time"
 )
 
@@ -28,10 +30,24 @@ type client struct {
 	ctx             context.Context
 	url             string
 	header          http.Header
-	body            io.Reader
 	reqBody         []byte
+	bodyReader      io.Reader
+	bodySize        int64
 	method          string
-	timeout         int64
+	timeout         time.Duration
+	timeoutSet      bool // WithTimeout(0)表示不限制超时，未设置时使用profile的超时
+	profile         string
+	service         string
+	pathParams      map[string]string
+	route           string
+	query           url.Values
+	retry           *RetryPolicy
+	breaker         *BreakerConfig
+	hedge           *hedge.Config
+	hedgeHosts      *hedgeHosts
+	tokens          *TokenSource
+	token           string // 本次请求使用的access token
+	fallback        Fallback
 	err             error
 	respBody        []byte
 	statusCode      int
@@ -41,8 +57,7 @@ type client struct {
 
 func NewReq(ctx context.Context) *client {
 	return &client{
-		ctx:     ctx,
-		timeout: defaultTimeout,
+		ctx: ctx,
 	}
 }
 
@@ -58,6 +73,73 @@ func (c *client) Post(url string) *client {
 	return c
 }
 
+func (c *client) Put(url string) *client {
+	c.url = url
+	c.method = http.MethodPut
+	return c
+}
+
+func (c *client) Patch(url string) *client {
+	c.url = url
+	c.method = http.MethodPatch
+	return c
+}
+
+func (c *client) Delete(url string) *client {
+	c.url = url
+	c.method = http.MethodDelete
+	return c
+}
+
+func (c *client) Head(url string) *client {
+	c.url = url
+	c.method = http.MethodHead
+	return c
+}
+
+// WithContext 替换请求的context
+func (c *client) WithContext(ctx context.Context) *client {
+	c.ctx = ctx
+	return c
+}
+
+// WithQuery 添加query参数，与url中已有的参数合并
+func (c *client) WithQuery(k string, v interface{}) *client {
+	if c.query == nil {
+		c.query = url.Values{}
+	}
+	c.query.Add(k, fmt.Sprint(v))
+	return c
+}
+
+// WithQueryMap 批量添加query参数
+func (c *client) WithQueryMap(query map[string]interface{}) *client {
+	for k, v := range query {
+		c.WithQuery(k, v)
+	}
+	return c
+}
+
+// WithForm 以表单提交，带文件时使用multipart/form-data，否则使用application/x-www-form-urlencoded
+func (c *client) WithForm(form map[string]interface{}, files ...FormFile) *client {
+	if len(files) > 0 {
+		fields := make(map[string]string, len(form))
+		for k, v := range form {
+			fields[k] = fmt.Sprint(v)
+		}
+		return c.WithMultipart(fields, files...)
+	}
+	values := url.Values{}
+	for k, v := range form {
+		values.Set(k, fmt.Sprint(v))
+	}
+	if c.header == nil {
+		c.header = http.Header{}
+	}
+	c.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.WithBody(values.Encode())
+}
+
 func (c *client) WithHeader(k string, v interface{}) *client {
 	if c.header == nil {
 		c.header = http.Header{}
@@ -67,6 +149,9 @@ func (c *client) WithHeader(k string, v interface{}) *client {
 }
 
 func (c *client) WithHeaderMap(header map[string]interface{}) *client {
+	if c.header == nil {
+		c.header = http.Header{}
+	}
 	for k, v := range header {
 		c.header.Add(k, fmt.Sprint(v))
 	}
@@ -74,6 +159,9 @@ func (c *client) WithHeaderMap(header map[string]interface{}) *client {
 }
 
 func (c *client) WithHeaders(keyAndValues ...interface{}) *client {
+	if c.header == nil {
+		c.header = http.Header{}
+	}
 	l := len(keyAndValues) - 1
 	for i := 0; i < l; i += 2 {
 		k := fmt.Sprint(keyAndValues[i])
@@ -87,12 +175,54 @@ func (c *client) WithHeaders(keyAndValues ...interface{}) *client {
 	return c
 }
 
+// WithTimeout 请求超时，单位秒，0表示不限制
 func (c *client) WithTimeout(timeout int64) *client {
+	return c.setTimeout(time.Duration(timeout) * time.Second)
+}
+
+// WithTimeoutMs 请求超时，单位毫秒，0表示不限制
+func (c *client) WithTimeoutMs(timeout int64) *client {
+	return c.setTimeout(ms(timeout))
+}
+
+func (c *client) setTimeout(timeout time.Duration) *client {
 	c.timeout = timeout
+	c.timeoutSet = true
+	return c
+}
+
+// WithRetry 本次请求的重试策略，覆盖profile中的配置
+func (c *client) WithRetry(policy RetryPolicy) *client {
+	c.retry = &policy
+	return c
+}
+
+// WithBreaker 本次请求的熔断配置，覆盖profile中的配置
+func (c *client) WithBreaker(cfg BreakerConfig) *client {
+	c.breaker = &cfg
+	return c
+}
+
+// WithFallback 请求失败或被熔断时的降级函数
+func (c *client) WithFallback(f Fallback) *client {
+	c.fallback = f
+	return c
+}
+
+// WithHedge 本次请求的对冲配置，覆盖profile中的配置，只对幂等方法生效
+func (c *client) WithHedge(cfg hedge.Config) *client {
+	c.hedge = &cfg
+	return c
+}
+
+// Profile 使用配置中指定名称的连接池，默认使用default
+func (c *client) Profile(name string) *client {
+	c.profile = name
 	return c
 }
 
 func (c *client) WithBody(body interface{}) *client {
+	c.bodyReader = nil
 	switch v := body.(type) {
 	case io.Reader:
 		buf, err := ioutil.ReadAll(v)
@@ -100,21 +230,17 @@ func (c *client) WithBody(body interface{}) *client {
 			c.err = err
 			return c
 		}
-		c.body = bytes.NewReader(buf)
 		c.reqBody = buf
 	case []byte:
-		c.body = bytes.NewReader(v)
-		c.reqBody = body.([]byte)
+		c.reqBody = v
 	case string:
-		c.body = strings.NewReader(v)
-		c.reqBody = []byte(body.(string))
+		c.reqBody = []byte(v)
 	default:
 		buf, err := jsoniter.Marshal(body)
 		if err != nil {
 			c.err = err
 			return c
 		}
-		c.body = bytes.NewReader(buf)
 		c.reqBody = buf
 	}
 	return c
@@ -122,80 +248,228 @@ func (c *client) WithBody(body interface{}) *client {
 
 type option func(c *client)
 
-func (c *client) Response() *client {
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: c.tlsClientConfig,
-			DialContext: (&net.Dialer{
-				Timeout:   time.Duration(c.timeout) * time.Second,
-				KeepAlive: time.Second * 5,
-			}).DialContext,
-			IdleConnTimeout:     time.Second * 5,
-			MaxIdleConnsPerHost: 10,
-		},
-		Timeout: time.Duration(c.timeout) * time.Second,
+// options 合并profile与本次请求的配置
+func (c *client) options() (*Profile, *http.Client, time.Duration, BreakerConfig, error) {
+	p, ok := GetProfile(c.profile)
+	if !ok {
+		return nil, nil, 0, BreakerConfig{}, fmt.Errorf("http client profile %s not found", c.profile)
 	}
-
-	if c.method == http.MethodGet {
-		c.body = nil
+	client := p.Client()
+	if c.tlsClientConfig != nil {
+		client = p.tlsClient(c.tlsClientConfig)
 	}
+	timeout := ms(p.cfg.Timeout)
+	if c.timeoutSet {
+		timeout = c.timeout
+	}
+	breaker := p.cfg.Breaker
+	if c.breaker != nil {
+		breaker = *c.breaker
+	}
+	return p, client, timeout, breaker, nil
+}
 
-	nowTime := time.Now()
-	req, err := http.NewRequest(c.method, c.url, c.body)
-	if err != nil {
-		c.err = err
+func (c *client) Response() *client {
+	if c.err != nil {
 		return c
 	}
-	req.Header = c.header
-	resp, err := client.Do(req)
+	p, client, timeout, breaker, err := c.options()
 	if err != nil {
 		c.err = err
 		return c
 	}
+	ctx := c.context()
+	c.tokens = p.TokenSource()
 
-	var traceId string
-	span, ok := c.ctx.Value(string(trace.CtxTraceSpanKey)).(trace.Span)
-	if ok {
-		traceId = span.Trace()
+	policy := p.cfg.Retry
+	if c.retry != nil {
+		policy = *c.retry
+	}
+	policy.setDefaults()
+	maxAttempts := 1
+	// 流式body无法重放，不重试
+	if policy.enabled() && policy.allowMethod(c.method) && c.bodyReader == nil {
+		maxAttempts = policy.MaxAttempts
+	}
+	if policy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ms(policy.Deadline))
+		defer cancel()
 	}
 
-	defer func() {
-		_ = resp.Body.Close()
-	}()
+	hedgeCfg := p.cfg.Hedge
+	if c.hedge != nil {
+		hedgeCfg = *c.hedge
+	}
+	var hp *hedge.Policy
+	if hedgeCfg.Enable && c.bodyReader == nil && idempotent(c.method) {
+		hp = getHedgePolicy(c.hedgeName(), hedgeCfg)
+	}
+
+	send := func(attempt int) (int, error) {
+		if hp != nil {
+			return c.doHedged(ctx, client, timeout, breaker, attempt, hp)
+		}
+		return c.do(ctx, client, timeout, breaker, attempt)
+	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	var b backoff.BackOff
+	for attempt := 1; ; attempt++ {
+		statusCode, err := send(attempt)
+		// token可能已被撤销，清除缓存后重新获取token再请求一次
+		if statusCode == http.StatusUnauthorized && c.retryToken() {
+			c.tokens.Invalidate(ctx, c.token)
+			statusCode, err = send(attempt)
+		}
+		if attempt >= maxAttempts || IsBreakerError(err) || !policy.shouldRetry(ctx, statusCode, err) {
+			break
+		}
+		if b == nil {
+			b = policy.newBackOff()
+		}
+		if !wait(ctx, b.NextBackOff()) {
+			break
+		}
+	}
+	c.runFallback(ctx, breaker)
+	return c
+}
+
+// retryToken 使用了TokenSource获取的token且请求可重放时，token被拒绝后可以重新获取token再请求
+func (c *client) retryToken() bool {
+	return c.tokens != nil && len(c.token) > 0 && c.bodyReader == nil
+}
+
+func (c *client) reset() {
+	c.err = nil
+	c.respBody = nil
+	c.statusCode = 0
+	c.status = ""
+}
+
+// newRequest 选择节点并创建请求，流式body只读取一次，缓存的body每次重新读取保证可重放
+func (c *client) newRequest(ctx context.Context, reqLog *headBuffer) (*http.Request, string, string, error) {
+	reqURL, address, err := c.resolve(ctx)
+	if err != nil {
+		return nil, "", "", err
+	}
+	var body io.Reader
+	if c.bodyReader != nil {
+		body = io.TeeReader(c.bodyReader, reqLog)
+	} else if c.method != http.MethodGet && c.method != http.MethodHead && c.reqBody != nil {
+		body = bytes.NewReader(c.reqBody)
+		_, _ = reqLog.Write(c.reqBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, reqURL, body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if c.bodyReader != nil {
+		req.ContentLength = c.bodySize
+		if c.bodySize == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	req.Header = c.header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	if c.tokens != nil && len(req.Header.Get("Authorization")) == 0 {
+		tok, err := c.tokens.Token(ctx)
+		if err != nil {
+			return nil, "", "", err
+		}
+		c.token = tok.AccessToken
+		req.Header.Set("Authorization", tok.Authorization())
+	}
+	return req, reqURL, address, nil
+}
+
+// withTimeout timeout小于等于0时不限制超时
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// do 发送一次请求，返回状态码和网络错误，结果写入c
+func (c *client) do(ctx context.Context, client *http.Client, timeout time.Duration, breaker BreakerConfig, attempt int) (int, error) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	c.reset()
+	nowTime := time.Now()
+	reqLog := newHeadBuffer(logBodyLimit)
+	req, reqURL, address, err := c.newRequest(ctx, reqLog)
 	if err != nil {
 		c.err = err
+		return 0, err
 	}
+	ctx, span := startSpan(ctx, req, attempt)
+	req = req.WithContext(ctx)
+
+	downstream := c.downstream(reqURL)
+	inFlight(downstream, 1)
+	callStart := time.Now()
+
+	var resp *http.Response
+	var respBody []byte
+	statusCode, err := c.withBreaker(breaker, reqURL, address, func() (int, error) {
+		var doErr error
+		resp, doErr = client.Do(req)
+		if doErr != nil {
+			c.putResult(address, 0, doErr)
+			return 0, doErr
+		}
+		respBody, doErr = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		c.putResult(address, resp.StatusCode, doErr)
+		return resp.StatusCode, doErr
+	})
+	inFlight(downstream, -1)
+	c.reportMetrics(downstream, time.Since(callStart), statusCode, err)
+	endSpan(span, statusCode, err)
+	c.logRequest(ctx, span, nowTime, attempt, reqURL, statusCode, reqLog.Bytes(), respBody, err)
 
-	// 日志打印
-	var logReplyBody, logReqBody []byte
-	logReplyBody = append(logReplyBody, body...)
-	if len(logReplyBody) > 512 {
-		logReplyBody = logReplyBody[0:512]
+	if err != nil {
+		c.err = err
+		return statusCode, err
 	}
+	c.respBody = respBody
+	c.statusCode = resp.StatusCode
+	c.status = resp.Status
+	return statusCode, nil
+}
 
-	logReqBody = append(logReqBody, c.reqBody...)
-	if len(logReqBody) > 512 {
-		logReqBody = logReqBody[0:512]
+// logRequest 打印业务日志，body只保留前logBodyLimit字节
+func (c *client) logRequest(ctx context.Context, span oteltrace.Span, start time.Time, attempt int, reqURL string, statusCode int, reqBody, respBody []byte, err error) {
+	traceId := trace.ExtraTraceID(ctx)
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		traceId = sc.TraceID().String()
+	}
+	if len(reqBody) > logBodyLimit {
+		reqBody = reqBody[:logBodyLimit]
+	}
+	if len(respBody) > logBodyLimit {
+		respBody = respBody[:logBodyLimit]
 	}
 
 	logItems := []interface{}{
-		"start", nowTime.Format(utils.TimeFormatYYYYMMDDHHmmSS),
-		"cost", math.Ceil(float64(time.Since(nowTime).Nanoseconds()) / 1e6),
+		"start", start.Format(utils.TimeFormatYYYYMMDDHHmmSS),
+		"cost", math.Ceil(float64(time.Since(start).Nanoseconds()) / 1e6),
 		"trace_id", traceId,
+		"attempt", attempt,
 		"req_method", c.method,
-		"req_uri", c.url,
-		"http_code", resp.StatusCode,
-		"req_body", string(logReqBody),
-		"resp_body", string(logReplyBody),
+		"req_uri", reqURL,
+		"http_code", statusCode,
+		"req_body", string(reqBody),
+		"resp_body", string(respBody),
+	}
+	if err != nil {
+		logItems = append(logItems, "error", err.Error())
 	}
 	logging.DefaultKit.B().Debugw("http_client", logItems...)
-
-	c.respBody = body
-	c.statusCode = resp.StatusCode
-	c.status = resp.Status
-	return c
 }
 
 func (c *client) TLSClientConfig(conf *tls.Config) *client {
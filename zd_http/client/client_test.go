@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerbsQueryForm(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		w.Header().Set("X-Method", r.Method)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.RawQuery + " " + r.PostForm.Encode() + " " + r.Header.Get("X-A")))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		c    *client
+		want string
+	}{
+		{NewReq(nil).WithContext(context.Background()).Put(srv.URL).WithHeaders("X-A", 1), "PUT   1"},
+		{NewReq(context.Background()).Patch(srv.URL).WithHeaderMap(map[string]interface{}{"X-A": "b"}), "PATCH   b"},
+		{NewReq(context.Background()).Delete(srv.URL+"?a=1").WithQuery("q", "a b&c"), "DELETE a=1&q=a+b%26c  "},
+		{NewReq(context.Background()).Get(srv.URL).WithQueryMap(map[string]interface{}{"page": 2}), "GET page=2  "},
+		{NewReq(context.Background()).Post(srv.URL).WithForm(map[string]interface{}{"name": "张三", "age": 18}), "POST  age=18&name=%E5%BC%A0%E4%B8%89 "},
+	}
+	for _, tc := range cases {
+		var got string
+		if err := tc.c.Response().ParseString(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+
+	var got string
+	if err := NewReq(context.Background()).Head(srv.URL).Response().ParseString(&got); err != nil || got != "" {
+		t.Fatalf("head got %q, err %v", got, err)
+	}
+}
@@ -0,0 +1,14 @@
+package clienttest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+)
+
+func TestMain(m *testing.M) {
+	l := logging.New()
+	logging.DefaultKit = logging.NewKit(l, l, l, l, l, l)
+	os.Exit(m.Run())
+}
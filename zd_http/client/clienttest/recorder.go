@@ -0,0 +1,362 @@
+// Package clienttest 为zd_http/client提供录制、回放请求的测试Transport
+//
+// 录制模式下请求发往真实下游，请求和响应按行写入fixture文件；
+// 回放模式下按method、url和body hash匹配fixture，不访问网络。
+// 设置环境变量ZD_HTTP_RECORD=1时以录制模式运行。
+package clienttest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	http_client "github.com/lfxnxf/zdy_tools/zd_http/client"
+)
+
+// EnvRecord 为1时以录制模式运行
+const EnvRecord = "ZD_HTTP_RECORD"
+
+// ErrUnmatched 严格模式下没有匹配的fixture
+var ErrUnmatched = errors.New("clienttest: unmatched request")
+
+type Mode int
+
+const (
+	ModeReplay Mode = iota
+	ModeRecord
+)
+
+// Rule header脱敏规则，Pattern为空时替换整个值，Remove为true时直接删除该header
+type Rule struct {
+	Header  string
+	Pattern *regexp.Regexp
+	Replace string
+	Remove  bool
+}
+
+// DefaultRules 默认脱敏鉴权信息，删除每次请求都会变化的trace头
+var DefaultRules = []Rule{
+	{Header: "Authorization", Replace: "***"},
+	{Header: "Cookie", Replace: "***"},
+	{Header: "Set-Cookie", Replace: "***"},
+	{Header: "X-Admin-Token", Replace: "***"},
+	{Header: "Traceparent", Remove: true},
+	{Header: "Tracestate", Remove: true},
+	{Header: "Baggage", Remove: true},
+	{Header: http_client.HeaderTraceIdKey, Remove: true},
+	{Header: http_client.HeaderSpanIdKey, Remove: true},
+}
+
+// Message 录制的请求或响应
+type Message struct {
+	StatusCode int         `json:"status_code,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"` // body不是utf8时以base64保存
+}
+
+// Entry fixture文件中的一行
+type Entry struct {
+	Method   string  `json:"method"`
+	URL      string  `json:"url"`
+	BodyHash string  `json:"body_hash"`
+	Request  Message `json:"request"`
+	Response Message `json:"response"`
+}
+
+func (e Entry) key() string {
+	return e.Method + " " + e.URL + " " + e.BodyHash
+}
+
+type Option func(*Recorder)
+
+// WithMode 指定模式，默认由环境变量决定
+func WithMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.mode = mode
+	}
+}
+
+// Strict 回放时遇到未录制的请求直接让测试失败，否则请求会发往真实下游
+func Strict() Option {
+	return func(r *Recorder) {
+		r.strict = true
+	}
+}
+
+// WithRules 追加header脱敏规则
+func WithRules(rules ...Rule) Option {
+	return func(r *Recorder) {
+		r.rules = append(r.rules, rules...)
+	}
+}
+
+// Recorder 录制、回放请求
+type Recorder struct {
+	t      testing.TB
+	path   string
+	mode   Mode
+	strict bool
+	rules  []Rule
+
+	mu      sync.Mutex
+	entries []Entry
+	replay  map[string][]Entry
+}
+
+// New 创建Recorder，回放模式下加载path中的fixture，录制模式下测试结束时写入path
+func New(t testing.TB, path string, opts ...Option) *Recorder {
+	t.Helper()
+	r := &Recorder{
+		t:      t,
+		path:   path,
+		rules:  append([]Rule(nil), DefaultRules...),
+		replay: make(map[string][]Entry),
+	}
+	if os.Getenv(EnvRecord) == "1" {
+		r.mode = ModeRecord
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.mode == ModeRecord {
+		t.Cleanup(func() {
+			if err := r.Save(); err != nil {
+				t.Errorf("clienttest: save %s: %v", r.path, err)
+			}
+		})
+		return r
+	}
+	if err := r.load(); err != nil {
+		t.Fatalf("clienttest: load %s: %v", r.path, err)
+	}
+	return r
+}
+
+// Install 拦截指定profile的请求，默认拦截default profile，测试结束时恢复
+func Install(t testing.TB, r *Recorder, profiles ...string) {
+	t.Helper()
+	if len(profiles) == 0 {
+		profiles = []string{http_client.DefaultProfile}
+	}
+	for _, name := range profiles {
+		p, ok := http_client.GetProfile(name)
+		if !ok {
+			t.Fatalf("clienttest: profile %s not found", name)
+		}
+		t.Cleanup(p.Intercept(r.Wrap))
+	}
+}
+
+// Wrap 包装next，可直接用于http_client.Profile.Intercept
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &transport{r: r, next: next}
+}
+
+// Entries 已录制或加载的全部请求
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Entry(nil), r.entries...)
+}
+
+// Save 把录制的请求写入fixture文件
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, e := range r.entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(r.path, buf.Bytes(), 0644)
+}
+
+func (r *Recorder) load() error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		r.entries = append(r.entries, e)
+		r.replay[e.key()] = append(r.replay[e.key()], e)
+	}
+	return scanner.Err()
+}
+
+// match 按录制顺序返回匹配的响应，用完后一直返回最后一个
+func (r *Recorder) match(key string) (Entry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queue := r.replay[key]
+	if len(queue) == 0 {
+		return Entry{}, false
+	}
+	e := queue[0]
+	if len(queue) > 1 {
+		r.replay[key] = queue[1:]
+	}
+	return e, true
+}
+
+func (r *Recorder) record(e Entry) {
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+}
+
+// scrub 按规则脱敏header
+func (r *Recorder) scrub(h http.Header) http.Header {
+	h = h.Clone()
+	for _, rule := range r.rules {
+		name := http.CanonicalHeaderKey(rule.Header)
+		values, ok := h[name]
+		if !ok {
+			continue
+		}
+		if rule.Remove {
+			delete(h, name)
+			continue
+		}
+		for i, v := range values {
+			if rule.Pattern == nil {
+				values[i] = rule.Replace
+			} else {
+				values[i] = rule.Pattern.ReplaceAllString(v, rule.Replace)
+			}
+		}
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+type transport struct {
+	r    *Recorder
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	e := Entry{
+		Method:   req.Method,
+		URL:      normalizeURL(req),
+		BodyHash: bodyHash(body),
+	}
+
+	if t.r.mode == ModeReplay {
+		if m, ok := t.r.match(e.key()); ok {
+			return m.response(req)
+		}
+		if t.r.strict {
+			t.r.t.Errorf("clienttest: unmatched request %s %s", e.Method, e.URL)
+			return nil, fmt.Errorf("%w: %s %s", ErrUnmatched, e.Method, e.URL)
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	e.Request = newMessage(0, t.r.scrub(req.Header), body)
+	e.Response = newMessage(resp.StatusCode, t.r.scrub(resp.Header), respBody)
+	t.r.record(e)
+	return resp, nil
+}
+
+func (e Entry) response(req *http.Request) (*http.Response, error) {
+	body := []byte(e.Response.Body)
+	if e.Response.BodyBase64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Response.Body); err != nil {
+			return nil, err
+		}
+	}
+	header := e.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(e.Response.StatusCode) + " " + http.StatusText(e.Response.StatusCode),
+		StatusCode:    e.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func newMessage(statusCode int, header http.Header, body []byte) Message {
+	m := Message{StatusCode: statusCode, Header: header}
+	if utf8.Valid(body) {
+		m.Body = string(body)
+	} else {
+		m.Body = base64.StdEncoding.EncodeToString(body)
+		m.BodyBase64 = true
+	}
+	return m
+}
+
+// normalizeURL query按key排序，避免参数顺序不同导致无法匹配
+func normalizeURL(req *http.Request) string {
+	u := *req.URL
+	u.RawQuery = u.Query().Encode()
+	u.Fragment = ""
+	return u.String()
+}
+
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	http_client "github.com/lfxnxf/zdy_tools/zd_http/client"
+)
+
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Query().Get("id")))
+	}))
+	path := filepath.Join(t.TempDir(), "account.jsonl")
+
+	rec := New(t, path, WithMode(ModeRecord))
+	p, _ := http_client.GetProfile(http_client.DefaultProfile)
+	restore := p.Intercept(rec.Wrap)
+	var got string
+	err := http_client.NewReq(context.Background()).
+		WithHeader("Authorization", "Bearer token").
+		Post(srv.URL + "/tenant?id=1&b=2").WithBody(`{"a":1}`).
+		Response().ParseString(&got)
+	restore()
+	if err != nil || got != "POST 1" {
+		t.Fatalf("got %q, err %v", got, err)
+	}
+	if err = rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	entries := rec.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries", len(entries))
+	}
+	if entries[0].Request.Header.Get("Authorization") != "***" || entries[0].Response.Header.Get("Set-Cookie") != "***" {
+		t.Fatalf("headers not scrubbed: %+v", entries[0])
+	}
+	if entries[0].Request.Header.Get(http_client.HeaderTraceIdKey) != "" {
+		t.Fatal("trace header should be removed")
+	}
+	url := srv.URL
+	srv.Close()
+
+	replay := New(t, path, Strict())
+	Install(t, replay)
+	got = ""
+	err = http_client.NewReq(context.Background()).
+		Post(url + "/tenant?b=2&id=1").WithBody(`{"a":1}`).
+		Response().ParseString(&got)
+	if err != nil || got != "POST 1" {
+		t.Fatalf("replay got %q, err %v", got, err)
+	}
+
+	ft := &fakeT{TB: t}
+	replay.t = ft
+	err = http_client.NewReq(context.Background()).
+		Post(url + "/tenant?b=2&id=1").WithBody(`{"a":2}`).
+		Response().ParseEmpty()
+	if !errors.Is(err, ErrUnmatched) || !ft.failed {
+		t.Fatalf("got err %v, failed %v", err, ft.failed)
+	}
+	if !strings.Contains(err.Error(), "/tenant") {
+		t.Fatalf("got err %v", err)
+	}
+}
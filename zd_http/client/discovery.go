@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/upstream"
+)
+
+// 上报给异常检测的结果，0成功，1~100连接错误，101~200请求错误
+const (
+	resultSuccess      upstream.Result = 0
+	resultConnectError upstream.Result = 1
+	resultRequestError upstream.Result = 101
+)
+
+var (
+	ErrServiceNotFound = errors.New("http client service not found")
+	ErrNoAvailableHost = errors.New("http client no available host")
+)
+
+var (
+	clusterManager = upstream.NewClusterManager()
+	serviceProtos  sync.Map // service -> scheme
+)
+
+// InitServices 按配置初始化服务发现集群
+func InitServices(clusters []upstream_config.Cluster) error {
+	for _, c := range clusters {
+		if err := clusterManager.InitService(c); err != nil {
+			return err
+		}
+		scheme := "http"
+		if strings.EqualFold(c.Proto, "https") {
+			scheme = "https"
+		}
+		serviceProtos.Store(c.Name, scheme)
+	}
+	return nil
+}
+
+// ClusterManager 返回http客户端使用的集群管理器
+func ClusterManager() *upstream.ClusterManager {
+	return clusterManager
+}
+
+// Service 按服务名发现下游，Get、Post等只需传入path
+func (c *client) Service(name string) *client {
+	c.service = name
+	return c
+}
+
+// WithHash 一致性hash的key，配合hash负载均衡使用
+func (c *client) WithHash(key interface{}) *client {
+	c.ctx = upstream.NewContextWithHash(c.context(), key)
+	return c
+}
+
+// WithSubset 按tag选择子集，kvs为key、value交替
+func (c *client) WithSubset(kvs ...string) *client {
+	c.ctx = upstream.InjectSubsetCarrier(c.context(), kvs)
+	return c
+}
+
+func (c *client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// resolve 未指定服务时直接使用url，否则选择一个节点拼接url
+func (c *client) resolve(ctx context.Context) (reqURL, address string, err error) {
+	if len(c.service) == 0 {
+		return c.buildURL(c.url), "", nil
+	}
+	scheme, ok := serviceProtos.Load(c.service)
+	if !ok {
+		return "", "", ErrServiceNotFound
+	}
+	host := clusterManager.ChooseHost(ctx, c.service)
+	// 对冲请求尽量选择不同的节点
+	for i := 0; i < hedgeChooseTimes && host != nil && c.hedgeHosts.contains(host.Address()); i++ {
+		host = clusterManager.ChooseHost(ctx, c.service)
+	}
+	if host == nil {
+		return "", "", ErrNoAvailableHost
+	}
+	address = host.Address()
+	c.hedgeHosts.add(address)
+	path := c.buildURL(c.url)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return scheme.(string) + "://" + address + path, address, nil
+}
+
+// putResult 上报请求结果，异常节点会被摘除
+func (c *client) putResult(address string, statusCode int, err error) {
+	// 对冲请求中被取消的请求不上报
+	if len(c.service) == 0 || len(address) == 0 || errors.Is(err, context.Canceled) {
+		return
+	}
+	clusterManager.PutResult(c.service, address, int(resultOf(statusCode, err)))
+}
+
+func resultOf(statusCode int, err error) upstream.Result {
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return resultConnectError
+		}
+		return resultRequestError
+	}
+	// 业务错误码也会返回500，只有服务不可用时摘除节点
+	if containsCode(defaultFailureCodes, statusCode) {
+		return resultRequestError
+	}
+	return resultSuccess
+}
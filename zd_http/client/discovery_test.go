@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+)
+
+func TestService(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	cluster := upstream_config.NewCluster()
+	cluster.Name = "test.account"
+	cluster.StaticEndpoints = strings.TrimPrefix(srv.URL, "http://")
+	if err := InitServices([]upstream_config.Cluster{cluster}); err != nil {
+		t.Fatal(err)
+	}
+
+	var path string
+	var err error
+	for i := 0; i < 50; i++ {
+		err = NewReq(context.Background()).Service("test.account").Get("/inner/user").Response().ParseString(&path)
+		if err != ErrNoAvailableHost {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/inner/user" {
+		t.Fatalf("got path %q", path)
+	}
+
+	if err = NewReq(context.Background()).Service("test.missing").Get("/").Response().ParseEmpty(); err != ErrServiceNotFound {
+		t.Fatalf("got err %v", err)
+	}
+}
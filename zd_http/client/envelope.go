@@ -0,0 +1,52 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/lfxnxf/zdy_tools/zd_error"
+)
+
+// ErrInvalidEnvelope 响应不是WrapResp结构
+var ErrInvalidEnvelope = errors.New("http client invalid envelope")
+
+// envelope 下游统一响应结构，与zd_http.WrapResp一致
+type envelope struct {
+	Code      string              `json:"code"`
+	Msg       string              `json:"message"`
+	Data      jsoniter.RawMessage `json:"data"`
+	RequestId string              `json:"requestId"`
+
+	Details *zd_error.Details `json:"details,omitempty"`
+}
+
+// ParseEnvelope 按WrapResp结构解析响应，data解析到data中
+// code不为成功时返回zd_error.RemoteError，可通过errors.As取出下游的code、message和requestId
+func (c *client) ParseEnvelope(data interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	var e envelope
+	if err := jsoniter.Unmarshal(c.respBody, &e); err != nil || len(e.Code) == 0 {
+		// 非WrapResp结构时，非200按http状态返回错误
+		if c.statusCode != http.StatusOK {
+			return errors.New(c.status)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+		}
+		return ErrInvalidEnvelope
+	}
+	if e.Code != zd_error.Success.Code() {
+		return zd_error.NewRemoteError(e.Code, e.Msg, e.RequestId).
+			WithHTTPStatus(c.statusCode).
+			WithDetails(e.Details)
+	}
+	if data == nil || len(e.Data) == 0 || string(e.Data) == "null" {
+		return nil
+	}
+	return jsoniter.Unmarshal(e.Data, data)
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lfxnxf/zdy_tools/zd_error"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte(`{"code":"Success","message":"success","data":{"name":"a"},"requestId":"r1"}`))
+		case "/biz":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"params error","message":"参数错误","requestId":"r2","details":{"invalidFields":[{"field":"Name","reason":"required"}]}}`))
+		case "/plain":
+			_, _ = w.Write([]byte(`hello`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	var data struct {
+		Name string `json:"name"`
+	}
+	if err := NewReq(context.Background()).Get(srv.URL + "/ok").Response().ParseEnvelope(&data); err != nil || data.Name != "a" {
+		t.Fatalf("got %+v, err %v", data, err)
+	}
+
+	err := NewReq(context.Background()).Get(srv.URL + "/biz").Response().ParseEnvelope(&data)
+	var re zd_error.RemoteError
+	if !errors.As(err, &re) {
+		t.Fatalf("got err %T %v", err, err)
+	}
+	if re.Code() != zd_error.ParamsErrorCode || re.Message() != "参数错误" || re.RequestId() != "r2" || re.RemoteHTTPStatus() != http.StatusBadRequest {
+		t.Fatalf("got %+v", re)
+	}
+	if !zd_error.ParamsError.Equal(err) {
+		t.Fatal("expected equal to ParamsError")
+	}
+	if d := zd_error.DetailsOf(err); d == nil || len(d.InvalidFields) != 1 {
+		t.Fatalf("got details %+v", d)
+	}
+
+	if err = NewReq(context.Background()).Get(srv.URL + "/plain").Response().ParseEnvelope(nil); !errors.Is(err, ErrInvalidEnvelope) {
+		t.Fatalf("got err %v", err)
+	}
+	if err = NewReq(context.Background()).Get(srv.URL + "/gone").Response().ParseEnvelope(nil); err == nil || errors.As(err, &re) {
+		t.Fatalf("got err %v", err)
+	}
+}
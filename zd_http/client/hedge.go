@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lfxnxf/zdy_tools/tools/hedge"
+)
+
+// hedgeChooseTimes 对冲请求选择不同节点的最大尝试次数
+const hedgeChooseTimes = 3
+
+type hedgeKey struct {
+	name string
+	cfg  hedge.Config
+}
+
+var hedgePolicies sync.Map // hedgeKey -> *hedge.Policy
+
+// getHedgePolicy 按下游和配置共享对冲预算和耗时统计，WithHedge使用不同配置时单独统计
+func getHedgePolicy(name string, cfg hedge.Config) *hedge.Policy {
+	key := hedgeKey{name: name, cfg: cfg}
+	if v, ok := hedgePolicies.Load(key); ok {
+		return v.(*hedge.Policy)
+	}
+	v, _ := hedgePolicies.LoadOrStore(key, hedge.NewPolicy(cfg))
+	return v.(*hedge.Policy)
+}
+
+// hedgeName 对冲统计粒度，服务名或host
+func (c *client) hedgeName() string {
+	if len(c.service) > 0 {
+		return c.service
+	}
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return c.url
+	}
+	return u.Host
+}
+
+// hedgeHosts 同一次请求的各个对冲请求已选择的节点
+type hedgeHosts struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (h *hedgeHosts) contains(addr string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, a := range h.addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *hedgeHosts) add(addr string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.addrs = append(h.addrs, addr)
+	h.mu.Unlock()
+}
+
+type hedgeResult struct {
+	c          *client
+	statusCode int
+	err        error
+}
+
+// doHedged 发送一次请求，超过对冲延迟仍未返回时向其他节点再发送请求，先成功返回的结果生效
+// 服务不可用的响应不算成功，全部失败时使用最后返回的结果，未使用服务发现时对冲请求发往同一个url
+func (c *client) doHedged(ctx context.Context, client *http.Client, timeout time.Duration, breaker BreakerConfig, attempt int, p *hedge.Policy) (int, error) {
+	hosts := new(hedgeHosts)
+	val, _ := p.Do(ctx, func(ctx context.Context, n int) (interface{}, error) {
+		// 每个对冲请求使用独立的副本，互不影响结果
+		cp := *c
+		cp.hedgeHosts = hosts
+		statusCode, err := cp.do(ctx, client, timeout, breaker, attempt)
+		r := &hedgeResult{c: &cp, statusCode: statusCode, err: err}
+		if err == nil {
+			err = cp.err
+		}
+		if err == nil && breaker.isFailure(statusCode) {
+			err = errServerError
+		}
+		return r, err
+	})
+	r := val.(*hedgeResult)
+	*c = *r.c
+	c.hedgeHosts = nil
+	return r.statusCode, r.err
+}
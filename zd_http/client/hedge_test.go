@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lfxnxf/zdy_tools/tools/hedge"
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+)
+
+func TestHedge(t *testing.T) {
+	var slowHits int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowHits, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		_, _ = w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	cluster := upstream_config.NewCluster()
+	cluster.Name = "test.hedge"
+	cluster.LBType = "RoundRobin"
+	cluster.StaticEndpoints = strings.TrimPrefix(slow.URL, "http://") + "," + strings.TrimPrefix(fast.URL, "http://")
+	if err := InitServices([]upstream_config.Cluster{cluster}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := hedge.Config{Enable: true, Delay: 20, BudgetPercent: 100}
+	waitHosts(t, "test.hedge")
+	// 轮询两个节点，连续的请求中一定有以慢节点为首选的请求
+	for i := 0; i < 4; i++ {
+		var got string
+		start := time.Now()
+		if err := NewReq(context.Background()).Service("test.hedge").Get("/").WithHedge(cfg).Response().ParseString(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != "fast" || time.Since(start) > 500*time.Millisecond {
+			t.Fatalf("got %q in %v", got, time.Since(start))
+		}
+	}
+	if atomic.LoadInt32(&slowHits) == 0 {
+		t.Fatal("slow host was never chosen, hedging not exercised")
+	}
+}
+
+func TestHedgeUnavailable(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(40 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ok.Close()
+
+	cluster := upstream_config.NewCluster()
+	cluster.Name = "test.hedge_unavailable"
+	cluster.LBType = "RoundRobin"
+	cluster.StaticEndpoints = strings.TrimPrefix(unavailable.URL, "http://") + "," + strings.TrimPrefix(ok.URL, "http://")
+	if err := InitServices([]upstream_config.Cluster{cluster}); err != nil {
+		t.Fatal(err)
+	}
+	waitHosts(t, "test.hedge_unavailable")
+
+	// 无论哪个节点先发送，503都比正常响应先返回，不算成功，等待另一个请求的结果
+	cfg := hedge.Config{Enable: true, Delay: 20, BudgetPercent: 100}
+	for i := 0; i < 4; i++ {
+		var got string
+		if err := NewReq(context.Background()).Service("test.hedge_unavailable").Get("/").WithHedge(cfg).Response().ParseString(&got); err != nil || got != "ok" {
+			t.Fatalf("attempt %d got %q, %v", i, got, err)
+		}
+	}
+}
+
+func TestGetHedgePolicy(t *testing.T) {
+	a := getHedgePolicy("test.policy", hedge.Config{Enable: true, Delay: 10})
+	if getHedgePolicy("test.policy", hedge.Config{Enable: true, Delay: 10}) != a {
+		t.Fatal("same config should share the policy")
+	}
+	b := getHedgePolicy("test.policy", hedge.Config{Enable: true, Delay: 30})
+	if b == a || b.Delay() != 30*time.Millisecond {
+		t.Fatalf("different config should use its own policy, delay %v", b.Delay())
+	}
+}
+
+// waitHosts 等待服务发现初始化两个节点
+func waitHosts(t *testing.T, service string) {
+	for i := 0; i < 100; i++ {
+		if len(clusterManager.ChooseAllHosts(context.Background(), service)) >= 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("service %s has no hosts", service)
+}
@@ -0,0 +1,11 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/lfxnxf/zdy_tools/discovery/discoverytest"
+)
+
+func TestMain(m *testing.M) {
+	discoverytest.Main(m)
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfxnxf/zdy_tools/tpc/inf/metrics"
+)
+
+// 未收到响应时上报的code，收到响应时code为http状态码
+const (
+	metricCodeNetworkError = 1 // 网络错误
+	metricCodeTimeout      = 2 // 超时或被取消
+	metricCodeBreaker      = 3 // 被熔断
+)
+
+const (
+	metricPrefix         = "HTTP."
+	metricInFlightPrefix = "HTTP.INFLIGHT."
+	metricRouteID        = "{id}"
+
+	metricClientTag  = "clientag"
+	metricClientHTTP = "http"
+)
+
+var (
+	inFlights sync.Map // downstream -> *int64
+
+	// metricEscaper 替换metrics名称中的分隔符
+	metricEscaper = strings.NewReplacer("|", "_", ",", "_", "=", "_")
+)
+
+// InitMetrics 注册http client metrics的成功码，2xx、3xx计为成功，只对clientag=http的metrics生效
+func InitMetrics() {
+	codes := make(map[int]int)
+	for code := 200; code < 400; code++ {
+		codes[code] = code
+	}
+	metrics.AddTagSuccessCode(metricClientTag, metricClientHTTP, codes)
+}
+
+// WithRoute 指定metrics中的路由模板，默认使用Endpoint配置的path或由url推导
+func (c *client) WithRoute(route string) *client {
+	c.route = route
+	return c
+}
+
+// downstream 服务名或host
+func (c *client) downstream(reqURL string) string {
+	if len(c.service) > 0 {
+		return c.service
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return "unknown"
+	}
+	return u.Host
+}
+
+// routeName 路由模板，path中的id替换为{id}，避免metrics数量膨胀
+func (c *client) routeName() string {
+	if len(c.route) > 0 {
+		return c.route
+	}
+	path := c.url
+	if idx := strings.Index(path, "://"); idx >= 0 {
+		path = path[idx+3:]
+		if slash := strings.Index(path, "/"); slash >= 0 {
+			path = path[slash:]
+		} else {
+			path = "/"
+		}
+	}
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		path = path[:idx]
+	}
+	return routeTemplate(path)
+}
+
+func routeTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if isIDSegment(seg) {
+			segments[i] = metricRouteID
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIDSegment 纯数字、uuid、长度不小于16的16进制串视为id
+func isIDSegment(seg string) bool {
+	if len(seg) == 0 {
+		return false
+	}
+	digits := true
+	for _, r := range seg {
+		switch {
+		case r >= '0' && r <= '9':
+		case r >= 'a' && r <= 'f', r >= 'A' && r <= 'F':
+			digits = false
+		case r == '-' && len(seg) == 36:
+			digits = false
+		default:
+			return false
+		}
+	}
+	return digits || len(seg) >= 16
+}
+
+// inFlight 调整下游的进行中请求数并上报
+func inFlight(downstream string, delta int64) {
+	v, ok := inFlights.Load(downstream)
+	if !ok {
+		v, _ = inFlights.LoadOrStore(downstream, new(int64))
+	}
+	n := atomic.AddInt64(v.(*int64), delta)
+	metrics.Gauge(metricInFlightPrefix+metricEscaper.Replace(downstream), int(n))
+}
+
+func metricCode(statusCode int, err error) int {
+	switch {
+	case err == nil:
+		return statusCode
+	case IsBreakerError(err):
+		return metricCodeBreaker
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return metricCodeTimeout
+	}
+	return metricCodeNetworkError
+}
+
+// reportMetrics 按下游和路由上报耗时和状态码
+func (c *client) reportMetrics(downstream string, cost time.Duration, statusCode int, err error) {
+	name := metricPrefix + metricEscaper.Replace(downstream) + "." + metricEscaper.Replace(c.routeName())
+	metrics.TimerDuration(name, cost, metrics.TagCode, metricCode(statusCode, err), metricClientTag, metricClientHTTP, "method", c.method)
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+func TestRouteTemplate(t *testing.T) {
+	cases := map[string]string{
+		"/inner/account/tenant/123":                         "/inner/account/tenant/{id}",
+		"/order/3f2b8c4e-1d2a-4b5c-9e8f-0a1b2c3d4e5f/items": "/order/{id}/items",
+		"/file/0123456789abcdef0123":                        "/file/{id}",
+		"/inner/account/department/list":                    "/inner/account/department/list",
+		"/user/cafe":                                        "/user/cafe",
+	}
+	for in, want := range cases {
+		if got := routeTemplate(in); got != want {
+			t.Errorf("routeTemplate(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	c := NewReq(context.Background()).Get("http://host:80/tenant/12?x=1")
+	if got := c.routeName(); got != "/tenant/{id}" {
+		t.Fatalf("got %q", got)
+	}
+	if got := c.WithRoute("get-tenant").routeName(); got != "get-tenant" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestReportMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_ = NewReq(context.Background()).Get(srv.URL + "/metrics/42").Response().ParseEmpty()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	var timer, gauge bool
+	gometrics.DefaultRegistry.Each(func(name string, i interface{}) {
+		if strings.HasPrefix(name, "HTTP."+host+"./metrics/{id}|") && strings.Contains(name, "code=404") {
+			timer = true
+		}
+		if name == "HTTP.INFLIGHT."+host {
+			gauge = i.(gometrics.Gauge).Value() == 0
+		}
+	})
+	if !timer || !gauge {
+		t.Fatalf("timer %v, gauge %v", timer, gauge)
+	}
+}
@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/lfxnxf/zdy_tools/tools/syncx"
+)
+
+const (
+	defaultOAuth2EarlyExpiry  = 60000  // 毫秒
+	defaultOAuth2RefreshAhead = 300000 // 毫秒
+	defaultOAuth2ExpiresIn    = 3600   // 秒，token接口未返回expires_in时使用
+
+	oauth2AuthStyleParams = "params"
+	oauth2CacheKeyPrefix  = "http_client:oauth2:"
+)
+
+var ErrOAuth2Token = errors.New("http client oauth2 token error")
+
+// OAuth2Config client-credentials模式获取token，时间单位均为毫秒
+type OAuth2Config struct {
+	TokenURL     string   `yaml:"token_url"` // 为空不启用
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	AuthStyle    string   `yaml:"auth_style"`    // header使用basic auth(默认)，params放在表单中
+	EarlyExpiry  int64    `yaml:"early_expiry"`  // 提前视为过期的时间
+	RefreshAhead int64    `yaml:"refresh_ahead"` // 距过期小于该时间时后台刷新
+	Redis        string   `yaml:"redis"`         // 缓存token的redis名称，为空只缓存在本地
+	CacheKey     string   `yaml:"cache_key"`     // redis中的key，默认http_client:oauth2:{client_id}
+}
+
+func (cfg OAuth2Config) enabled() bool {
+	return len(cfg.TokenURL) > 0
+}
+
+func (cfg *OAuth2Config) setDefaults() {
+	if cfg.EarlyExpiry <= 0 {
+		cfg.EarlyExpiry = defaultOAuth2EarlyExpiry
+	}
+	if cfg.RefreshAhead <= 0 {
+		cfg.RefreshAhead = defaultOAuth2RefreshAhead
+	}
+	if len(cfg.CacheKey) == 0 {
+		cfg.CacheKey = oauth2CacheKeyPrefix + cfg.ClientID
+	}
+}
+
+// Token oauth2 token
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int64     `json:"expires_in"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// Authorization 请求头中的值
+func (t *Token) Authorization() string {
+	tokenType := t.TokenType
+	if len(tokenType) == 0 || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenCache 多副本共享token的缓存，*redis.Redis实现了该接口
+type TokenCache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Setex(ctx context.Context, key, value string, seconds int) error
+	Del(ctx context.Context, keys ...string) (int, error)
+}
+
+var tokenCaches sync.Map // name -> TokenCache
+
+// RegisterTokenCache 注册token缓存，OAuth2Config.Redis按名称引用
+func RegisterTokenCache(name string, cache TokenCache) {
+	tokenCaches.Store(name, cache)
+}
+
+// TokenSource 获取并缓存token，并发请求共享同一次获取
+type TokenSource struct {
+	cfg     OAuth2Config
+	client  *http.Client
+	timeout time.Duration
+
+	mu         sync.RWMutex
+	token      *Token
+	flight     syncx.SingleFlight
+	refreshing *syncx.AtomicBool
+}
+
+// NewTokenSource client用于请求token接口
+func NewTokenSource(cfg OAuth2Config, client *http.Client, timeout time.Duration) *TokenSource {
+	cfg.setDefaults()
+	return &TokenSource{
+		cfg:        cfg,
+		client:     client,
+		timeout:    timeout,
+		flight:     syncx.NewSingleFlight(),
+		refreshing: syncx.NewAtomicBool(),
+	}
+}
+
+// Token 返回有效的token，快过期时在后台刷新
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.RLock()
+	tok := s.token
+	s.mu.RUnlock()
+	now := time.Now()
+	if tok != nil && now.Add(ms(s.cfg.EarlyExpiry)).Before(tok.Expiry) {
+		if now.Add(ms(s.cfg.RefreshAhead)).After(tok.Expiry) && s.refreshing.CompareAndSwap(false, true) {
+			go s.refresh()
+		}
+		return tok, nil
+	}
+	v, err := s.flight.Do(s.cfg.CacheKey, func() (interface{}, error) {
+		// 并发调用共享同一次获取，不使用第一个调用方的ctx，避免其取消导致其他调用方一起失败
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		return s.fetch(ctx, ms(s.cfg.EarlyExpiry))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Token), nil
+}
+
+// Invalidate token被拒绝时清除缓存，只清除与accessToken相同的token，避免清掉已刷新的token
+func (s *TokenSource) Invalidate(ctx context.Context, accessToken string) {
+	s.mu.Lock()
+	if s.token != nil && s.token.AccessToken == accessToken {
+		s.token = nil
+	}
+	s.mu.Unlock()
+	if cache := s.cache(); cache != nil {
+		if tok := s.loadCache(ctx, cache); tok != nil && tok.AccessToken == accessToken {
+			_, _ = cache.Del(ctx, s.cfg.CacheKey)
+		}
+	}
+}
+
+// refresh 后台刷新，共享缓存中的token已被其他副本刷新时直接使用
+func (s *TokenSource) refresh() {
+	defer s.refreshing.Set(false)
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	_, _ = s.flight.Do(s.cfg.CacheKey, func() (interface{}, error) {
+		return s.fetch(ctx, ms(s.cfg.RefreshAhead))
+	})
+}
+
+func (s *TokenSource) cache() TokenCache {
+	if len(s.cfg.Redis) == 0 {
+		return nil
+	}
+	if v, ok := tokenCaches.Load(s.cfg.Redis); ok {
+		return v.(TokenCache)
+	}
+	return nil
+}
+
+func (s *TokenSource) loadCache(ctx context.Context, cache TokenCache) *Token {
+	val, err := cache.Get(ctx, s.cfg.CacheKey)
+	if err != nil || len(val) == 0 {
+		return nil
+	}
+	var tok Token
+	if err = jsoniter.UnmarshalFromString(val, &tok); err != nil || len(tok.AccessToken) == 0 {
+		return nil
+	}
+	return &tok
+}
+
+// fetch 优先使用共享缓存中有效期大于minValid的token，否则请求token接口
+func (s *TokenSource) fetch(ctx context.Context, minValid time.Duration) (*Token, error) {
+	cache := s.cache()
+	if cache != nil {
+		if tok := s.loadCache(ctx, cache); tok != nil && time.Now().Add(minValid).Before(tok.Expiry) {
+			s.setToken(tok)
+			return tok, nil
+		}
+	}
+
+	tok, err := s.request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.setToken(tok)
+	if cache != nil {
+		ttl := time.Until(tok.Expiry) - ms(s.cfg.EarlyExpiry)
+		if val, err := jsoniter.MarshalToString(tok); err == nil && ttl >= time.Second {
+			_ = cache.Setex(ctx, s.cfg.CacheKey, val, int(ttl/time.Second))
+		}
+	}
+	return tok, nil
+}
+
+func (s *TokenSource) setToken(tok *Token) {
+	s.mu.Lock()
+	s.token = tok
+	s.mu.Unlock()
+}
+
+// request 以client_credentials模式请求token接口
+func (s *TokenSource) request(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	if s.cfg.AuthStyle == oauth2AuthStyleParams {
+		form.Set("client_id", s.cfg.ClientID)
+		form.Set("client_secret", s.cfg.ClientSecret)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.cfg.AuthStyle != oauth2AuthStyleParams {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s", ErrOAuth2Token, resp.Status, body)
+	}
+	var tok Token
+	if err = jsoniter.Unmarshal(body, &tok); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuth2Token, err)
+	}
+	if len(tok.AccessToken) == 0 {
+		return nil, fmt.Errorf("%w: empty access_token", ErrOAuth2Token)
+	}
+	if tok.ExpiresIn <= 0 {
+		tok.ExpiresIn = defaultOAuth2ExpiresIn
+	}
+	tok.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return &tok, nil
+}
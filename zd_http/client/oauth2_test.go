@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memTokenCache struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (c *memTokenCache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m[key], nil
+}
+
+func (c *memTokenCache) Setex(ctx context.Context, key, value string, seconds int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = value
+	return nil
+}
+
+func (c *memTokenCache) Del(ctx context.Context, keys ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		delete(c.m, k)
+	}
+	return len(keys), nil
+}
+
+// revokedToken 编号不大于revoked的token已被撤销
+func revokedToken(authorization string, revoked int32) bool {
+	var n int32
+	if _, err := fmt.Sscanf(authorization, "Bearer t%d", &n); err != nil {
+		return false
+	}
+	return n <= revoked
+}
+
+func TestOAuth2(t *testing.T) {
+	var issued, revoked, apiHits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			id, secret, _ := r.BasicAuth()
+			if id != "partner" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			n := atomic.AddInt32(&issued, 1)
+			_, _ = fmt.Fprintf(w, `{"access_token":"t%d","token_type":"bearer","expires_in":3600}`, n)
+		default:
+			atomic.AddInt32(&apiHits, 1)
+			// revoked之前签发的token被撤销
+			if revokedToken(r.Header.Get("Authorization"), atomic.LoadInt32(&revoked)) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+		}
+	}))
+	defer srv.Close()
+
+	cache := &memTokenCache{m: map[string]string{}}
+	RegisterTokenCache("test-oauth2", cache)
+	_, err := RegisterProfile(ProfileConfig{
+		Name: "test-oauth2",
+		OAuth2: OAuth2Config{
+			TokenURL:     srv.URL + "/token",
+			ClientID:     "partner",
+			ClientSecret: "s3cret",
+			Redis:        "test-oauth2",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got string
+			if err := NewReq(context.Background()).Profile("test-oauth2").Get(srv.URL + "/api").Response().ParseString(&got); err != nil || got != "Bearer t1" {
+				t.Errorf("got %q, err %v", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&issued); n != 1 {
+		t.Fatalf("issued %d tokens", n)
+	}
+	if len(cache.m) != 1 {
+		t.Fatal("token should be cached")
+	}
+
+	atomic.StoreInt32(&revoked, 1)
+	var got string
+	if err = NewReq(context.Background()).Profile("test-oauth2").Get(srv.URL + "/api").Response().ParseString(&got); err != nil || got != "Bearer t2" {
+		t.Fatalf("got %q, err %v", got, err)
+	}
+
+	// 流式请求同样在token被拒绝时重新获取
+	atomic.StoreInt32(&revoked, 2)
+	body, err := NewReq(context.Background()).Profile("test-oauth2").Get(srv.URL + "/api").Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(buf) != "Bearer t3" {
+		t.Fatalf("stream got %q", buf)
+	}
+
+	// 调用方自己设置的Authorization被拒绝时不重试，也不清除token
+	n := atomic.LoadInt32(&apiHits)
+	err = NewReq(context.Background()).Profile("test-oauth2").Get(srv.URL+"/api").WithHeader("Authorization", "Bearer t1").Response().ParseEmpty()
+	if err == nil || atomic.LoadInt32(&apiHits) != n+1 || atomic.LoadInt32(&issued) != 3 {
+		t.Fatalf("custom authorization err %v, hits %d, issued %d", err, atomic.LoadInt32(&apiHits)-n, atomic.LoadInt32(&issued))
+	}
+}
+
+func TestTokenSourceDetachedContext(t *testing.T) {
+	var issued int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		n := atomic.AddInt32(&issued, 1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"t%d","expires_in":3600}`, n)
+	}))
+	defer srv.Close()
+
+	s := NewTokenSource(OAuth2Config{TokenURL: srv.URL, ClientID: "partner"}, http.DefaultClient, time.Second)
+	// 第一个调用方取消后，共享同一次获取的其他调用方仍能拿到token
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = s.Token(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	tok, err := s.Token(context.Background())
+	wg.Wait()
+	if err != nil || tok.AccessToken != "t1" {
+		t.Fatalf("got %v, %v", tok, err)
+	}
+	if n := atomic.LoadInt32(&issued); n != 1 {
+		t.Fatalf("issued %d tokens", n)
+	}
+}
@@ -0,0 +1,292 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfxnxf/zdy_tools/tools/hedge"
+)
+
+const (
+	DefaultProfile = "default"
+
+	defaultMaxIdleConns          = 100
+	defaultMaxIdleConnsPerHost   = 10
+	defaultIdleConnTimeout       = 90000 // 毫秒
+	defaultDialTimeout           = 3000
+	defaultKeepAlive             = 30000
+	defaultTLSHandshakeTimeout   = 5000
+	defaultExpectContinueTimeout = 1000
+	defaultRequestTimeout        = defaultTimeout * 1000
+
+	maxTLSClients = 32 // 每个profile缓存的自定义tls配置Transport数量
+)
+
+// ProfileConfig http客户端配置，时间单位均为毫秒
+type ProfileConfig struct {
+	Name                  string `yaml:"name"`
+	Timeout               int64  `yaml:"timeout"` // 整个请求超时，可被WithTimeout覆盖
+	MaxIdleConns          int    `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int    `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int    `yaml:"max_conns_per_host"` // 0不限制
+	IdleConnTimeout       int64  `yaml:"idle_conn_timeout"`
+	DialTimeout           int64  `yaml:"dial_timeout"`
+	KeepAlive             int64  `yaml:"keepalive"` // tcp keepalive间隔，小于0关闭
+	TLSHandshakeTimeout   int64  `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout int64  `yaml:"response_header_timeout"` // 0不限制
+	Proxy                 string `yaml:"proxy"`                   // 为空时使用环境变量HTTP_PROXY等
+	DisableKeepAlives     bool   `yaml:"disable_keepalives"`
+	InsecureSkipVerify    bool   `yaml:"insecure_skip_verify"`
+
+	Retry   RetryPolicy   `yaml:"retry"`   // 默认重试策略，可被WithRetry覆盖
+	Breaker BreakerConfig `yaml:"breaker"` // 默认熔断配置，可被WithBreaker覆盖
+	Hedge   hedge.Config  `yaml:"hedge"`   // 默认对冲配置，可被WithHedge覆盖
+	OAuth2  OAuth2Config  `yaml:"oauth2"`  // 请求自动携带client-credentials模式获取的token
+}
+
+func (cfg *ProfileConfig) setDefaults() {
+	if len(cfg.Name) == 0 {
+		cfg.Name = DefaultProfile
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultRequestTimeout
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = defaultKeepAlive
+	}
+	if cfg.TLSHandshakeTimeout <= 0 {
+		cfg.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+}
+
+func ms(v int64) time.Duration {
+	return time.Duration(v) * time.Millisecond
+}
+
+// Profile 按配置共享的连接池，同名profile的请求复用同一个Transport
+type Profile struct {
+	cfg       ProfileConfig
+	transport *http.Transport
+	client    *http.Client
+	stats     *transportStats
+	hook      *atomic.Value // hookFunc
+	tokens    *TokenSource
+
+	tlsMu      sync.Mutex
+	tlsClients map[string]*http.Client // tlsConfigKey -> client
+	tlsKeys    []string                // 按创建顺序，超过maxTLSClients时淘汰最早的
+}
+
+func NewProfile(cfg ProfileConfig) (*Profile, error) {
+	cfg.setDefaults()
+	proxy := http.ProxyFromEnvironment
+	if len(cfg.Proxy) > 0 {
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("http client profile %s invalid proxy: %w", cfg.Name, err)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   ms(cfg.DialTimeout),
+			KeepAlive: ms(cfg.KeepAlive),
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       ms(cfg.IdleConnTimeout),
+		TLSHandshakeTimeout:   ms(cfg.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: ms(cfg.ResponseHeaderTimeout),
+		ExpectContinueTimeout: ms(defaultExpectContinueTimeout),
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+	}
+	if cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	p := &Profile{
+		cfg:        cfg,
+		transport:  transport,
+		stats:      new(transportStats),
+		hook:       new(atomic.Value),
+		tlsClients: make(map[string]*http.Client),
+	}
+	p.client = &http.Client{Transport: &statsTransport{next: transport, stats: p.stats, hook: p.hook}}
+	if cfg.OAuth2.enabled() {
+		p.tokens = NewTokenSource(cfg.OAuth2, p.client, ms(cfg.Timeout))
+	}
+	return p, nil
+}
+
+func (p *Profile) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Profile) Config() ProfileConfig {
+	return p.cfg
+}
+
+// Client 返回共享的http.Client，超时由请求context控制
+func (p *Profile) Client() *http.Client {
+	return p.client
+}
+
+// TokenSource 未配置oauth2时返回nil
+func (p *Profile) TokenSource() *TokenSource {
+	return p.tokens
+}
+
+// Stats 返回连接池统计
+func (p *Profile) Stats() TransportStats {
+	return p.stats.snapshot()
+}
+
+// CloseIdleConnections 关闭空闲连接
+func (p *Profile) CloseIdleConnections() {
+	p.transport.CloseIdleConnections()
+	p.tlsMu.Lock()
+	defer p.tlsMu.Unlock()
+	for _, c := range p.tlsClients {
+		c.CloseIdleConnections()
+	}
+}
+
+// Intercept 用wrap包装profile的Transport，返回恢复函数，主要用于测试时录制、回放请求
+func (p *Profile) Intercept(wrap func(next http.RoundTripper) http.RoundTripper) (restore func()) {
+	p.hook.Store(hookFunc(wrap))
+	return func() {
+		p.hook.Store(hookFunc(nil))
+	}
+}
+
+// tlsClient 自定义tls配置的请求使用单独的Transport
+// 相同证书、CA等配置的请求共用Transport，缓存数量有上限，淘汰时关闭其空闲连接
+func (p *Profile) tlsClient(conf *tls.Config) *http.Client {
+	key := tlsConfigKey(conf)
+	p.tlsMu.Lock()
+	defer p.tlsMu.Unlock()
+	if c, ok := p.tlsClients[key]; ok {
+		return c
+	}
+	if len(p.tlsKeys) >= maxTLSClients {
+		oldest := p.tlsKeys[0]
+		p.tlsKeys = p.tlsKeys[1:]
+		p.tlsClients[oldest].CloseIdleConnections()
+		delete(p.tlsClients, oldest)
+	}
+	transport := p.transport.Clone()
+	transport.TLSClientConfig = conf
+	c := &http.Client{Transport: &statsTransport{next: transport, stats: p.stats, hook: p.hook}}
+	p.tlsClients[key] = c
+	p.tlsKeys = append(p.tlsKeys, key)
+	return c
+}
+
+// tlsConfigKey 按证书、CA和校验相关字段生成缓存key
+// 带回调的配置无法比较，按对象区分
+func tlsConfigKey(conf *tls.Config) string {
+	if conf.GetClientCertificate != nil || conf.VerifyPeerCertificate != nil || conf.VerifyConnection != nil ||
+		conf.GetConfigForClient != nil || conf.GetCertificate != nil {
+		return fmt.Sprintf("%p", conf)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%t|%d|%d|%q|", conf.ServerName, conf.InsecureSkipVerify, conf.MinVersion, conf.MaxVersion, conf.NextProtos)
+	for _, cert := range conf.Certificates {
+		for _, der := range cert.Certificate {
+			h.Write(der)
+		}
+		h.Write([]byte{'|'})
+	}
+	if conf.RootCAs != nil {
+		for _, subject := range conf.RootCAs.Subjects() {
+			h.Write(subject)
+		}
+	} else {
+		h.Write([]byte("system roots"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var (
+	profiles   sync.Map // name -> *Profile
+	profileMtx sync.Mutex
+)
+
+// InitProfiles 按配置注册profile并注册metrics成功码，已存在的同名profile会被替换
+func InitProfiles(cfgs []ProfileConfig) error {
+	InitMetrics()
+	for _, cfg := range cfgs {
+		if _, err := RegisterProfile(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RegisterProfile(cfg ProfileConfig) (*Profile, error) {
+	p, err := NewProfile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	profileMtx.Lock()
+	old, loaded := profiles.Load(p.cfg.Name)
+	profiles.Store(p.cfg.Name, p)
+	profileMtx.Unlock()
+	if loaded {
+		old.(*Profile).CloseIdleConnections()
+	}
+	return p, nil
+}
+
+// GetProfile 按名称取profile，未注册的default profile使用默认配置创建
+func GetProfile(name string) (*Profile, bool) {
+	if len(name) == 0 {
+		name = DefaultProfile
+	}
+	if v, ok := profiles.Load(name); ok {
+		return v.(*Profile), true
+	}
+	if name != DefaultProfile {
+		return nil, false
+	}
+	profileMtx.Lock()
+	defer profileMtx.Unlock()
+	if v, ok := profiles.Load(name); ok {
+		return v.(*Profile), true
+	}
+	p, _ := NewProfile(ProfileConfig{Name: DefaultProfile})
+	profiles.Store(DefaultProfile, p)
+	return p, true
+}
+
+// Stats 返回全部profile的连接池统计
+func Stats() map[string]TransportStats {
+	res := make(map[string]TransportStats)
+	profiles.Range(func(k, v interface{}) bool {
+		res[k.(string)] = v.(*Profile).Stats()
+		return true
+	})
+	return res
+}
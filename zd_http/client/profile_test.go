@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProfileReuse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name":"test"}`))
+	}))
+	defer srv.Close()
+
+	p, err := RegisterProfile(ProfileConfig{Name: "test", Timeout: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		var resp struct {
+			Name string `json:"name"`
+		}
+		if err = NewReq(context.Background()).Profile("test").Get(srv.URL).Response().ParseJson(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Name != "test" {
+			t.Fatalf("got name %q", resp.Name)
+		}
+	}
+	stats := p.Stats()
+	if stats.Requests != 3 || stats.NewConns != 1 || stats.ReusedConns != 2 || stats.InFlight != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if err = NewReq(context.Background()).Profile("missing").Get(srv.URL).Response().ParseEmpty(); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+}
+
+func TestProfileInFlight(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`data`))
+	}))
+	defer srv.Close()
+
+	p, err := RegisterProfile(ProfileConfig{Name: "test-inflight", Timeout: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 收到响应头后body未关闭前请求仍在进行中
+	body, err := NewReq(context.Background()).Profile("test-inflight").Get(srv.URL).Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Stats().InFlight; n != 1 {
+		t.Fatalf("in flight %d before close, want 1", n)
+	}
+	_ = body.Close()
+	_ = body.Close()
+	if n := p.Stats().InFlight; n != 0 {
+		t.Fatalf("in flight %d after close, want 0", n)
+	}
+}
+
+func TestProfileTLSClient(t *testing.T) {
+	p, err := NewProfile(ProfileConfig{Name: "test-tls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每次请求新建的相同配置共用Transport
+	a := p.tlsClient(&tls.Config{ServerName: "account", MinVersion: tls.VersionTLS12})
+	b := p.tlsClient(&tls.Config{ServerName: "account", MinVersion: tls.VersionTLS12})
+	if a != b {
+		t.Fatal("equal tls configs should share a client")
+	}
+	if c := p.tlsClient(&tls.Config{ServerName: "order"}); c == a {
+		t.Fatal("different tls configs should not share a client")
+	}
+	// 带回调的配置按对象区分
+	verify := func(tls.ConnectionState) error { return nil }
+	if p.tlsClient(&tls.Config{VerifyConnection: verify}) == p.tlsClient(&tls.Config{VerifyConnection: verify}) {
+		t.Fatal("tls configs with callbacks should not share a client")
+	}
+
+	for i := 0; i < maxTLSClients*2; i++ {
+		p.tlsClient(&tls.Config{ServerName: fmt.Sprintf("host-%d", i)})
+	}
+	if n := len(p.tlsClients); n != maxTLSClients || len(p.tlsKeys) != maxTLSClients {
+		t.Fatalf("cached %d tls clients, want %d", n, maxTLSClients)
+	}
+}
+
+func TestProfileTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	if _, err := RegisterProfile(ProfileConfig{Name: "test-timeout", Timeout: 20}); err != nil {
+		t.Fatal(err)
+	}
+	// 未设置时使用profile的超时
+	if err := NewReq(context.Background()).Profile("test-timeout").Get(srv.URL).Response().ParseEmpty(); err == nil {
+		t.Fatal("expected profile timeout")
+	}
+	if err := NewReq(context.Background()).Profile("test-timeout").WithTimeoutMs(500).Get(srv.URL).Response().ParseEmpty(); err != nil {
+		t.Fatalf("WithTimeoutMs(500) error = %v", err)
+	}
+	// 0表示不限制超时
+	if err := NewReq(context.Background()).Profile("test-timeout").WithTimeout(0).Get(srv.URL).Response().ParseEmpty(); err != nil {
+		t.Fatalf("WithTimeout(0) error = %v", err)
+	}
+	body, err := NewReq(context.Background()).Profile("test-timeout").WithTimeout(0).Get(srv.URL).Stream()
+	if err != nil {
+		t.Fatalf("Stream() with WithTimeout(0) error = %v", err)
+	}
+	body.Close()
+}
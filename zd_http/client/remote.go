@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// remote配置中的保留字段，其余字段均为接口名到path的映射
+const (
+	remoteKeyURL     = "url"
+	remoteKeyService = "service"
+	remoteKeyProfile = "profile"
+	remoteKeyTimeout = "timeout"
+	remoteKeyRetry   = "retry"
+)
+
+// Remote 一个下游服务，url与service二选一，service表示走服务发现
+type Remote struct {
+	URL       string
+	Service   string
+	Profile   string
+	Timeout   int64 // 毫秒
+	Retry     *RetryPolicy
+	Endpoints map[string]string
+}
+
+// RemoteConfig 配置中的remote段，key为下游名称
+type RemoteConfig map[string]Remote
+
+func (r *Remote) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("remote must be a mapping, line %d", value.Line)
+	}
+	r.Endpoints = make(map[string]string)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, val := value.Content[i].Value, value.Content[i+1]
+		var err error
+		switch key {
+		case remoteKeyURL:
+			err = val.Decode(&r.URL)
+		case remoteKeyService:
+			err = val.Decode(&r.Service)
+		case remoteKeyProfile:
+			err = val.Decode(&r.Profile)
+		case remoteKeyTimeout:
+			err = val.Decode(&r.Timeout)
+		case remoteKeyRetry:
+			r.Retry = new(RetryPolicy)
+			err = val.Decode(r.Retry)
+		default:
+			var path string
+			err = val.Decode(&path)
+			r.Endpoints[key] = path
+		}
+		if err != nil {
+			return fmt.Errorf("remote key %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+var (
+	remotes   = RemoteConfig{}
+	remoteMtx sync.RWMutex
+)
+
+// InitRemotes 加载remote配置，同名下游会被覆盖
+func InitRemotes(cfg RemoteConfig) error {
+	for name, r := range cfg {
+		if len(r.URL) == 0 && len(r.Service) == 0 {
+			return fmt.Errorf("remote %s has neither url nor service", name)
+		}
+		if len(r.URL) > 0 {
+			if _, err := url.Parse(r.URL); err != nil {
+				return fmt.Errorf("remote %s invalid url: %w", name, err)
+			}
+		}
+	}
+	remoteMtx.Lock()
+	for name, r := range cfg {
+		remotes[name] = r
+	}
+	remoteMtx.Unlock()
+	return nil
+}
+
+// GetRemote 按名称取下游配置
+func GetRemote(name string) (Remote, bool) {
+	remoteMtx.RLock()
+	r, ok := remotes[name]
+	remoteMtx.RUnlock()
+	return r, ok
+}
+
+// Endpoint 按"下游.接口"创建请求，默认GET，例如Endpoint(ctx, "account.get-tenant-by-user")
+func Endpoint(ctx context.Context, name string) *client {
+	c := NewReq(ctx)
+	c.method = "GET"
+	idx := strings.Index(name, ".")
+	if idx <= 0 {
+		c.err = fmt.Errorf("invalid endpoint name %q", name)
+		return c
+	}
+	r, ok := GetRemote(name[:idx])
+	if !ok {
+		c.err = fmt.Errorf("remote %s not found", name[:idx])
+		return c
+	}
+	path, ok := r.Endpoints[name[idx+1:]]
+	if !ok {
+		c.err = fmt.Errorf("endpoint %s not found", name)
+		return c
+	}
+	if len(r.Service) > 0 {
+		c.service = r.Service
+		c.url = path
+	} else {
+		c.url = strings.TrimRight(r.URL, "/") + "/" + strings.TrimLeft(path, "/")
+	}
+	c.route = path
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		c.route = path[:idx]
+	}
+	c.profile = r.Profile
+	if r.Timeout > 0 {
+		c.setTimeout(ms(r.Timeout))
+	}
+	c.retry = r.Retry
+	return c
+}
+
+// WithMethod 设置请求方法，配合Endpoint使用
+func (c *client) WithMethod(method string) *client {
+	c.method = strings.ToUpper(method)
+	return c
+}
+
+// WithPathParam 替换path中的{key}或:key
+func (c *client) WithPathParam(key string, value interface{}) *client {
+	if c.pathParams == nil {
+		c.pathParams = make(map[string]string)
+	}
+	c.pathParams[key] = url.PathEscape(fmt.Sprint(value))
+	return c
+}
+
+// WithPathParams 批量替换path参数
+func (c *client) WithPathParams(params map[string]interface{}) *client {
+	for k, v := range params {
+		c.WithPathParam(k, v)
+	}
+	return c
+}
+
+// expandPath 替换url中的path参数
+func expandPath(rawURL string, params map[string]string) string {
+	if len(params) == 0 {
+		return rawURL
+	}
+	prefix, path := "", rawURL
+	if idx := strings.Index(rawURL, "://"); idx >= 0 {
+		if slash := strings.Index(rawURL[idx+3:], "/"); slash >= 0 {
+			prefix, path = rawURL[:idx+3+slash], rawURL[idx+3+slash:]
+		} else {
+			return rawURL
+		}
+	}
+	query := ""
+	if q := strings.Index(path, "?"); q >= 0 {
+		path, query = path[:q], path[q:]
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			if v, ok := params[seg[1:]]; ok {
+				segments[i] = v
+			}
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			if v, ok := params[seg[1:len(seg)-1]]; ok {
+				segments[i] = v
+			}
+		}
+	}
+	return prefix + strings.Join(segments, "/") + query
+}
+
+// buildURL 替换path参数并合并query参数
+func (c *client) buildURL(rawURL string) string {
+	rawURL = expandPath(rawURL, c.pathParams)
+	if len(c.query) == 0 {
+		return rawURL
+	}
+	fragment := ""
+	if idx := strings.Index(rawURL, "#"); idx >= 0 {
+		rawURL, fragment = rawURL[:idx], rawURL[idx:]
+	}
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+		if strings.HasSuffix(rawURL, "?") || strings.HasSuffix(rawURL, "&") {
+			sep = ""
+		}
+	}
+	return rawURL + sep + c.query.Encode() + fragment
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lfxnxf/zdy_tools/zd_error"
+)
+
+func TestRemoteUnmarshal(t *testing.T) {
+	var cfg struct {
+		Remote RemoteConfig `yaml:"remote"`
+	}
+	in := `
+remote:
+  account:
+    url: http://127.0.0.1:30720
+    timeout: 800
+    retry:
+      max_attempts: 2
+    get-tenant-by-user: /inner/account/tenant/list/by-user
+    get-tenant-by-id: /inner/account/tenant/{id}
+`
+	if err := yaml.Unmarshal([]byte(in), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	r := cfg.Remote["account"]
+	if r.URL != "http://127.0.0.1:30720" || r.Timeout != 800 || r.Retry == nil || r.Retry.MaxAttempts != 2 {
+		t.Fatalf("got %+v", r)
+	}
+	if len(r.Endpoints) != 2 || r.Endpoints["get-tenant-by-id"] != "/inner/account/tenant/{id}" {
+		t.Fatalf("got endpoints %v", r.Endpoints)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	params := map[string]string{"id": "12", "name": "a%20b"}
+	cases := map[string]string{
+		"http://host/tenant/{id}":          "http://host/tenant/12",
+		"http://host/tenant/:id/:name?x=1": "http://host/tenant/12/a%20b?x=1",
+		"/tenant/{id}/{other}":             "/tenant/12/{other}",
+		"http://host":                      "http://host",
+	}
+	for in, want := range cases {
+		if got := expandPath(in, params); got != want {
+			t.Errorf("expandPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant/7":
+			_, _ = w.Write([]byte(`{"code":"Success","message":"ok","data":{"id":7}}`))
+		default:
+			_, _ = w.Write([]byte(`{"code":"TenantNotFound","message":"tenant not found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	err := InitRemotes(RemoteConfig{"test-account": {
+		URL:       srv.URL + "/",
+		Endpoints: map[string]string{"get-tenant": "/tenant/{id}"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tenant struct {
+		Id int `json:"id"`
+	}
+	err = Endpoint(context.Background(), "test-account.get-tenant").WithPathParam("id", 7).Response().ParseEnvelope(&tenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.Id != 7 {
+		t.Fatalf("got tenant %+v", tenant)
+	}
+
+	err = Endpoint(context.Background(), "test-account.get-tenant").WithPathParam("id", 8).Response().ParseEnvelope(&tenant)
+	if zd_error.Cause(err).Code() != "TenantNotFound" {
+		t.Fatalf("got err %v", err)
+	}
+
+	if err = Endpoint(context.Background(), "test-account.missing").Response().ParseEmpty(); err == nil {
+		t.Fatal("expected endpoint not found")
+	}
+	if err = InitRemotes(RemoteConfig{"bad": {}}); err == nil {
+		t.Fatal("expected error for remote without url")
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cenk/backoff"
+)
+
+const (
+	defaultRetryInitialInterval = 100 // 毫秒
+	defaultRetryMaxInterval     = 2000
+	defaultRetryMultiplier      = 2
+	defaultRetryJitter          = 0.5
+)
+
+var defaultRetryOn = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// RetryPolicy 重试策略，时间单位均为毫秒
+type RetryPolicy struct {
+	MaxAttempts        int     `yaml:"max_attempts"`         // 总尝试次数，包含第一次，小于等于1不重试
+	InitialInterval    int64   `yaml:"initial_interval"`     // 第一次重试前的等待时间
+	MaxInterval        int64   `yaml:"max_interval"`         // 单次等待上限
+	Multiplier         float64 `yaml:"multiplier"`           // 等待时间增长倍数
+	Jitter             float64 `yaml:"jitter"`               // 随机抖动比例，0~1
+	RetryOn            []int   `yaml:"retry_on"`             // 需要重试的http状态码，默认502、503、504
+	NoNetworkRetry     bool    `yaml:"no_network_retry"`     // 网络错误不重试
+	RetryNonIdempotent bool    `yaml:"retry_non_idempotent"` // 非幂等方法(POST、PATCH)也重试
+	Deadline           int64   `yaml:"deadline"`             // 包含全部重试的总时长，0不限制
+}
+
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+func (p *RetryPolicy) setDefaults() {
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = defaultRetryInitialInterval
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = defaultRetryMaxInterval
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = defaultRetryJitter
+	}
+	if len(p.RetryOn) == 0 {
+		p.RetryOn = defaultRetryOn
+	}
+}
+
+func (p RetryPolicy) newBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = ms(p.InitialInterval)
+	b.MaxInterval = ms(p.MaxInterval)
+	b.Multiplier = p.Multiplier
+	b.RandomizationFactor = p.Jitter
+	b.MaxElapsedTime = 0 // 总时长由Deadline通过context控制
+	b.Reset()
+	return b
+}
+
+// allowMethod 默认只重试幂等方法
+func (p RetryPolicy) allowMethod(method string) bool {
+	return p.RetryNonIdempotent || idempotent(method)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry 根据本次结果判断是否需要重试
+func (p RetryPolicy) shouldRetry(ctx context.Context, statusCode int, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !p.NoNetworkRetry
+	}
+	for _, code := range p.RetryOn {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// wait 等待下一次重试，context结束时返回false
+func wait(ctx context.Context, d time.Duration) bool {
+	if d == backoff.Stop {
+		return false
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetry(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&hits, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialInterval: 1, MaxInterval: 5}
+
+	var resp string
+	if err := NewReq(context.Background()).WithRetry(policy).Get(srv.URL).Response().ParseString(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp != "ok" || atomic.LoadInt64(&hits) != 3 {
+		t.Fatalf("got %q after %d attempts", resp, hits)
+	}
+
+	// POST默认不重试
+	atomic.StoreInt64(&hits, 0)
+	if err := NewReq(context.Background()).WithRetry(policy).Post(srv.URL).WithBody("x").Response().ParseEmpty(); err == nil {
+		t.Fatal("expected error without retry")
+	}
+	if atomic.LoadInt64(&hits) != 1 {
+		t.Fatalf("post attempted %d times", hits)
+	}
+
+	policy.RetryNonIdempotent = true
+	atomic.StoreInt64(&hits, 0)
+	if err := NewReq(context.Background()).WithRetry(policy).Post(srv.URL).WithBody("x").Response().ParseEmpty(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryTokenError(t *testing.T) {
+	var tokenHits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			// 第一次获取token失败
+			if atomic.AddInt64(&tokenHits, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"t1","token_type":"bearer","expires_in":3600}`))
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	_, err := RegisterProfile(ProfileConfig{
+		Name:   "test-retry-token",
+		OAuth2: OAuth2Config{TokenURL: srv.URL + "/token", ClientID: "partner", ClientSecret: "s3cret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不重试时返回获取token的错误
+	if err = NewReq(context.Background()).Profile("test-retry-token").Get(srv.URL).Response().ParseEmpty(); err == nil {
+		t.Fatal("expected token error")
+	}
+
+	atomic.StoreInt64(&tokenHits, 0)
+	policy := RetryPolicy{MaxAttempts: 2, InitialInterval: 1, MaxInterval: 5}
+	var resp string
+	if err = NewReq(context.Background()).Profile("test-retry-token").WithRetry(policy).Get(srv.URL).Response().ParseString(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp != "Bearer t1" || atomic.LoadInt64(&tokenHits) != 2 {
+		t.Fatalf("got %q after %d token requests", resp, tokenHits)
+	}
+}
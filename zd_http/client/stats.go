@@ -0,0 +1,86 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// TransportStats 连接池统计，计数从profile创建开始累计
+type TransportStats struct {
+	Requests    int64 `json:"requests"`
+	Errors      int64 `json:"errors"`
+	InFlight    int64 `json:"in_flight"`
+	NewConns    int64 `json:"new_conns"`    // 新建连接数
+	ReusedConns int64 `json:"reused_conns"` // 复用连接数
+	IdleConns   int64 `json:"idle_conns"`   // 从空闲池取到的连接数
+}
+
+type transportStats struct {
+	requests    int64
+	errors      int64
+	inFlight    int64
+	newConns    int64
+	reusedConns int64
+	idleConns   int64
+}
+
+func (s *transportStats) snapshot() TransportStats {
+	return TransportStats{
+		Requests:    atomic.LoadInt64(&s.requests),
+		Errors:      atomic.LoadInt64(&s.errors),
+		InFlight:    atomic.LoadInt64(&s.inFlight),
+		NewConns:    atomic.LoadInt64(&s.newConns),
+		ReusedConns: atomic.LoadInt64(&s.reusedConns),
+		IdleConns:   atomic.LoadInt64(&s.idleConns),
+	}
+}
+
+// statsTransport 统计请求数和连接复用情况
+type statsTransport struct {
+	next  http.RoundTripper
+	stats *transportStats
+	hook  *atomic.Value
+}
+
+// hookFunc 拦截请求的包装函数
+type hookFunc func(next http.RoundTripper) http.RoundTripper
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.stats.requests, 1)
+	atomic.AddInt64(&t.stats.inFlight, 1)
+
+	ct := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.stats.reusedConns, 1)
+			} else {
+				atomic.AddInt64(&t.stats.newConns, 1)
+			}
+			if info.WasIdle {
+				atomic.AddInt64(&t.stats.idleConns, 1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+	next := t.next
+	if t.hook != nil {
+		if wrap, _ := t.hook.Load().(hookFunc); wrap != nil {
+			next = wrap(next)
+		}
+	}
+	resp, err := next.RoundTrip(req)
+	done := func() { atomic.AddInt64(&t.stats.inFlight, -1) }
+	if err != nil {
+		atomic.AddInt64(&t.stats.errors, 1)
+		done()
+		return resp, err
+	}
+	// 请求在body关闭后才结束，协议升级的body要保留io.ReadWriteCloser，不做包装
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		done()
+		return resp, nil
+	}
+	resp.Body = &streamBody{Reader: resp.Body, body: resp.Body, onClose: done}
+	return resp, nil
+}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logBodyLimit 业务日志中请求、响应body的最大长度
+const logBodyLimit = 512
+
+// headBuffer 只保留写入的前max字节，用于流式body的日志
+type headBuffer struct {
+	buf []byte
+	max int
+}
+
+func newHeadBuffer(max int) *headBuffer {
+	return &headBuffer{max: max}
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	if room := h.max - len(h.buf); room > 0 {
+		if len(p) > room {
+			h.buf = append(h.buf, p[:room]...)
+		} else {
+			h.buf = append(h.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+func (h *headBuffer) Bytes() []byte {
+	return h.buf
+}
+
+// WithBodyReader 流式发送请求body，size为body长度，未知时传-1使用chunked编码
+// 流式body只能读取一次，请求不会重试
+func (c *client) WithBodyReader(r io.Reader, size int64) *client {
+	c.bodyReader = r
+	c.bodySize = size
+	c.reqBody = nil
+	return c
+}
+
+// FormFile multipart上传的文件，Size必须与Reader的长度一致
+type FormFile struct {
+	Field       string
+	FileName    string
+	ContentType string // 默认application/octet-stream
+	Reader      io.Reader
+	Size        int64
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// WithMultipart 以multipart/form-data流式上传，文件内容不会读入内存
+func (c *client) WithMultipart(fields map[string]string, files ...FormFile) *client {
+	var (
+		readers []io.Reader
+		size    int64
+		buf     = new(bytes.Buffer)
+	)
+	w := multipart.NewWriter(buf)
+	// flush 把已写入的boundary和header作为一段body
+	flush := func() {
+		if buf.Len() == 0 {
+			return
+		}
+		b := append([]byte(nil), buf.Bytes()...)
+		readers = append(readers, bytes.NewReader(b))
+		size += int64(len(b))
+		buf.Reset()
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := w.WriteField(k, fields[k]); err != nil {
+			c.err = err
+			return c
+		}
+	}
+	for _, f := range files {
+		if f.Size < 0 || f.Reader == nil {
+			c.err = fmt.Errorf("http client multipart file %s has unknown size", f.Field)
+			return c
+		}
+		contentType := f.ContentType
+		if len(contentType) == 0 {
+			contentType = "application/octet-stream"
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(f.Field), quoteEscaper.Replace(f.FileName)))
+		h.Set("Content-Type", contentType)
+		if _, err := w.CreatePart(h); err != nil {
+			c.err = err
+			return c
+		}
+		flush()
+		readers = append(readers, io.LimitReader(f.Reader, f.Size))
+		size += f.Size
+	}
+	if err := w.Close(); err != nil {
+		c.err = err
+		return c
+	}
+	flush()
+
+	if c.header == nil {
+		c.header = http.Header{}
+	}
+	c.header.Set("Content-Type", w.FormDataContentType())
+	if len(c.method) == 0 || c.method == http.MethodGet {
+		c.method = http.MethodPost
+	}
+	return c.WithBodyReader(io.MultiReader(readers...), size)
+}
+
+// streamBody 响应body，Close时结束span并打印日志
+type streamBody struct {
+	io.Reader
+	body    io.ReadCloser
+	once    sync.Once
+	onClose func()
+}
+
+func (b *streamBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+// Stream 发送请求并返回响应body，调用方必须Close
+// 响应不会缓存，也不重试，只在token被拒绝时重新获取token再请求一次，timeout只限制收到响应头之前的时间
+func (c *client) Stream() (io.ReadCloser, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	p, client, timeout, breaker, err := c.options()
+	if err != nil {
+		c.err = err
+		return nil, err
+	}
+	c.tokens = p.TokenSource()
+	body, err := c.stream(client, timeout, breaker)
+	// token可能已被撤销，清除缓存后重新获取token再请求一次
+	if c.statusCode == http.StatusUnauthorized && c.retryToken() {
+		c.tokens.Invalidate(c.context(), c.token)
+		body, err = c.stream(client, timeout, breaker)
+	}
+	return body, err
+}
+
+// stream 发送一次流式请求
+func (c *client) stream(client *http.Client, timeout time.Duration, breaker BreakerConfig) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(c.context())
+	// timeout为0时不限制
+	stopTimer := func() bool { return false }
+	if timeout > 0 {
+		stopTimer = time.AfterFunc(timeout, cancel).Stop
+	}
+
+	c.reset()
+	nowTime := time.Now()
+	reqLog := newHeadBuffer(logBodyLimit)
+	req, reqURL, address, err := c.newRequest(ctx, reqLog)
+	if err != nil {
+		stopTimer()
+		cancel()
+		c.err = err
+		return nil, err
+	}
+	ctx, span := startSpan(ctx, req, 1)
+	req = req.WithContext(ctx)
+
+	downstream := c.downstream(reqURL)
+	inFlight(downstream, 1)
+
+	var resp *http.Response
+	statusCode, err := c.withBreaker(breaker, reqURL, address, func() (int, error) {
+		var doErr error
+		resp, doErr = client.Do(req)
+		if doErr != nil {
+			c.putResult(address, 0, doErr)
+			return 0, doErr
+		}
+		c.putResult(address, resp.StatusCode, nil)
+		return resp.StatusCode, nil
+	})
+	stopTimer()
+	c.reportMetrics(downstream, time.Since(nowTime), statusCode, err)
+	if err != nil {
+		inFlight(downstream, -1)
+		endSpan(span, statusCode, err)
+		c.logRequest(ctx, span, nowTime, 1, reqURL, statusCode, reqLog.Bytes(), nil, err)
+		cancel()
+		c.err = err
+		return nil, err
+	}
+	c.statusCode = resp.StatusCode
+	c.status = resp.Status
+
+	respLog := newHeadBuffer(logBodyLimit)
+	body := &streamBody{
+		Reader: io.TeeReader(resp.Body, respLog),
+		body:   resp.Body,
+		onClose: func() {
+			inFlight(downstream, -1)
+			endSpan(span, statusCode, nil)
+			c.logRequest(ctx, span, nowTime, 1, reqURL, statusCode, reqLog.Bytes(), respLog.Bytes(), nil)
+			cancel()
+		},
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(body, logBodyLimit))
+		_ = body.Close()
+		c.err = errors.New(c.status)
+		return nil, c.err
+	}
+	return body, nil
+}
+
+// Download 把响应body直接写入文件，返回写入的字节数
+// 先写入临时文件，成功后再重命名，失败时不会留下不完整的文件
+func (c *client) Download(path string) (int64, error) {
+	body, err := c.Stream()
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmp := f.Name()
+	n, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return n, err
+	}
+	return n, nil
+}
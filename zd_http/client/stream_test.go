@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHeadBuffer(t *testing.T) {
+	h := newHeadBuffer(4)
+	_, _ = h.Write([]byte("ab"))
+	_, _ = h.Write([]byte("cdef"))
+	if string(h.Bytes()) != "abcd" {
+		t.Fatalf("got %q", h.Bytes())
+	}
+}
+
+func TestStreamAndDownload(t *testing.T) {
+	export := strings.Repeat("x", 10*1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(export))
+	}))
+	defer srv.Close()
+
+	body, err := NewReq(context.Background()).Get(srv.URL + "/export").Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(body)
+	_ = body.Close()
+	if err != nil || string(data) != export {
+		t.Fatalf("got %d bytes, err %v", len(data), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sub", "export.csv")
+	n, err := NewReq(context.Background()).Get(srv.URL + "/export").Download(path)
+	if err != nil || n != int64(len(export)) {
+		t.Fatalf("got %d, err %v", n, err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != export {
+		t.Fatalf("got file %d bytes", len(b))
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.csv")
+	if _, err = NewReq(context.Background()).Get(srv.URL + "/missing").Download(missing); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("file should not exist, err %v", err)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	content := strings.Repeat("y", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength <= int64(len(content)) {
+			http.Error(w, "bad content length", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, h, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(f)
+		if string(b) != content || h.Filename != `a"b.txt` {
+			http.Error(w, "bad file", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(r.FormValue("tenant")))
+	}))
+	defer srv.Close()
+
+	var got string
+	err := NewReq(context.Background()).Post(srv.URL).
+		WithMultipart(map[string]string{"tenant": "t1"}, FormFile{
+			Field:    "file",
+			FileName: `a"b.txt`,
+			Reader:   strings.NewReader(content),
+			Size:     int64(len(content)),
+		}).
+		Response().ParseString(&got)
+	if err != nil || got != "t1" {
+		t.Fatalf("got %q, err %v", got, err)
+	}
+
+	err = NewReq(context.Background()).Post(srv.URL).
+		WithMultipart(nil, FormFile{Field: "file", Reader: strings.NewReader(""), Size: -1}).
+		Response().ParseEmpty()
+	if err == nil {
+		t.Fatal("expected error for unknown size")
+	}
+}
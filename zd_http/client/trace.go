@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/lfxnxf/zdy_tools/trace"
+)
+
+const tracerName = "zd_http/client"
+
+var (
+	HeaderTraceIdKey = http.CanonicalHeaderKey("x-trace-id")
+	HeaderSpanIdKey  = http.CanonicalHeaderKey("x-span-id")
+)
+
+// parentContext 取上游span，http服务端中间件把span放在gin上下文中
+func parentContext(ctx context.Context) context.Context {
+	if oteltrace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	if span, ok := ctx.Value(trace.CtxKeySpanContext).(oteltrace.Span); ok {
+		return oteltrace.ContextWithSpan(ctx, span)
+	}
+	return ctx
+}
+
+// startSpan 为一次请求创建client span，并把trace信息注入请求头
+func startSpan(ctx context.Context, req *http.Request, attempt int) (context.Context, oteltrace.Span) {
+	tracer := otel.GetTracerProvider().Tracer(tracerName)
+	ctx, span := tracer.Start(
+		parentContext(ctx),
+		req.Method+" "+req.URL.Path,
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(req)...),
+		oteltrace.WithAttributes(attribute.Int("http.attempt", attempt)),
+	)
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// 兼容旧的trace头，未接入otel时沿用上下文中的trace_id
+	traceId, spanId := trace.ExtraTraceID(ctx), ""
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		traceId = sc.TraceID().String()
+		spanId = sc.SpanID().String()
+	}
+	if len(traceId) > 0 {
+		req.Header.Set(HeaderTraceIdKey, traceId)
+	}
+	if len(spanId) > 0 {
+		req.Header.Set(HeaderSpanIdKey, spanId)
+	}
+	return ctx, span
+}
+
+// endSpan 记录响应状态和错误
+func endSpan(span oteltrace.Span, statusCode int, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if statusCode > 0 {
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(statusCode)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(statusCode))
+	}
+	span.End()
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// setTestTracer 替换全局的TracerProvider和propagator，测试结束后恢复
+func setTestTracer(t *testing.T) {
+	tp, prop := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	provider := sdktrace.NewTracerProvider()
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(prop)
+	})
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+func TestTraceInject(t *testing.T) {
+	setTestTracer(t)
+
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+	if err := NewReq(ctx).Get(srv.URL).Response().ParseEmpty(); err != nil {
+		t.Fatal(err)
+	}
+
+	traceId := parent.SpanContext().TraceID().String()
+	if header.Get(HeaderTraceIdKey) != traceId {
+		t.Fatalf("x-trace-id %q, want %q", header.Get(HeaderTraceIdKey), traceId)
+	}
+	if !strings.Contains(header.Get("traceparent"), traceId) {
+		t.Fatalf("traceparent %q not in trace %s", header.Get("traceparent"), traceId)
+	}
+	if header.Get(HeaderSpanIdKey) == parent.SpanContext().SpanID().String() {
+		t.Fatal("expected a new client span")
+	}
+}
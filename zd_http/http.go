@@ -1,9 +1,9 @@
 package zd_http
 
 import (
-	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -17,40 +17,60 @@ type WrapResp struct {
 	Msg       string      `json:"message"`
 	Data      interface{} `json:"data"`
 	RequestId string      `json:"requestId"`
+
+	Details *zd_error.Details `json:"details,omitempty"`
 }
 
-func newWrapResp(data interface{}, err error, traceId string) WrapResp {
+func newWrapResp(data interface{}, err error, traceId, locale string) WrapResp {
 	var e = zd_error.Cause(err)
 	return WrapResp{
 		Code:      e.Code(),
-		Msg:       e.Message(),
+		Msg:       zd_error.LocalizedMessage(e, locale),
 		Data:      data,
 		RequestId: traceId,
+		Details:   zd_error.DetailsOf(err),
+	}
+}
+
+// Locale 返回请求语言，优先取Request的context中的locale，其次取Accept-Language
+func Locale(c *gin.Context) string {
+	if c.Request != nil {
+		if locale := zd_error.LocaleFromContext(c.Request.Context()); len(locale) > 0 {
+			return locale
+		}
 	}
+	return zd_error.MatchAcceptLanguage(c.GetHeader("Accept-Language"))
 }
 
 func WriteJson(c *gin.Context, data interface{}, err error) {
-	w := newWrapResp(data, err, trace.ExtraTraceID(c))
-	// 所有都返回200
-	c.JSON(http.StatusOK, w)
+	w := newWrapResp(data, err, trace.ExtraTraceID(c), Locale(c))
+	if w.Details != nil && w.Details.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.FormatInt(w.Details.RetryAfter, 10))
+	}
+	// 未注册http状态码的错误码返回200
+	c.JSON(zd_error.HTTPStatus(err, http.StatusOK), w)
 	c.Abort()
 }
 
 func WriteParamsError(c *gin.Context, err error, data interface{}) {
 	var isParamsError bool
 	var msg string
+	details := zd_error.NewDetails()
 	obj := reflect.TypeOf(data)
 	if validErr, ok := err.(validator.ValidationErrors); ok {
 		for _, e := range validErr {
+			reason := e.Tag()
 			if f, exist := obj.Elem().FieldByName(e.Field()); exist && len(f.Tag.Get("msg")) > 0 {
 				isParamsError = true
-				msg = fmt.Sprintf("参数错误，%s", f.Tag.Get("msg"))
+				msg = zd_error.ParamsErrorMessage(Locale(c), f.Tag.Get("msg"))
+				reason = f.Tag.Get("msg")
 			}
+			details.AddInvalidField(e.Field(), reason)
 		}
 	}
 	if isParamsError {
-		WriteJson(c, nil, zd_error.AddSpecialError(zd_error.ParamsErrorCode, msg))
+		WriteJson(c, nil, zd_error.AddSpecialError(zd_error.ParamsErrorCode, msg).WithDetails(details))
 	} else {
-		WriteJson(c, nil, zd_error.ParamsError)
+		WriteJson(c, nil, zd_error.ParamsError.WithDetails(details))
 	}
 }
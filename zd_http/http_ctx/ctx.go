@@ -1,7 +1,6 @@
 package http_ctx
 
 import (
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/lfxnxf/zdy_tools/trace"
@@ -18,19 +17,29 @@ type WrapResp struct {
 	Msg       string      `json:"message"`
 	Data      interface{} `json:"data"`
 	RequestId string      `json:"requestId"`
+
+	Details *zd_error.Details `json:"details,omitempty"`
 }
 
 const (
 	RespKey = "response_data"
 )
 
-func NewWrapResp(data interface{}, err error, traceId string) WrapResp {
+// NewWrapResp 生成响应，指定locale时返回对应语言的消息
+func NewWrapResp(data interface{}, err error, traceId string, locale ...string) WrapResp {
 	var e = zd_error.Cause(err)
+	var msg string
+	if len(locale) > 0 {
+		msg = zd_error.LocalizedMessage(e, locale[0])
+	} else {
+		msg = e.Message()
+	}
 	return WrapResp{
 		Code:      e.Code(),
-		Msg:       e.Message(),
+		Msg:       msg,
 		Data:      data,
 		RequestId: traceId,
+		Details:   zd_error.DetailsOf(err),
 	}
 }
 
@@ -38,13 +47,23 @@ type HttpContext struct {
 	*gin.Context
 }
 
+// Locale 返回请求语言，优先取Request的context中的locale，其次取Accept-Language
+func (c *HttpContext) Locale() string {
+	if c.Request != nil {
+		if locale := zd_error.LocaleFromContext(c.Request.Context()); len(locale) > 0 {
+			return locale
+		}
+	}
+	return zd_error.MatchAcceptLanguage(c.GetHeader("Accept-Language"))
+}
+
 func (c *HttpContext) WriteJson(data interface{}, err error) {
-	w := NewWrapResp(data, err, trace.ExtraTraceID(c))
-	if w.Code != "" {
-		c.JSON(http.StatusInternalServerError, w)
-	} else {
-		c.JSON(http.StatusOK, w)
+	w := NewWrapResp(data, err, trace.ExtraTraceID(c), c.Locale())
+	if w.Details != nil && w.Details.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.FormatInt(w.Details.RetryAfter, 10))
 	}
+	// 未注册http状态码的错误码返回500
+	c.JSON(zd_error.HTTPStatus(err, http.StatusInternalServerError), w)
 	//c.Set(RespKey, w)
 	//c.JSON(http.StatusOK, w)
 	//c.Abort()
@@ -53,19 +72,23 @@ func (c *HttpContext) WriteJson(data interface{}, err error) {
 func (c *HttpContext) WriteParamsError(err error, data interface{}) {
 	var isParamsError bool
 	var msg string
+	details := zd_error.NewDetails()
 	obj := reflect.TypeOf(data)
 	if validErr, ok := err.(validator.ValidationErrors); ok {
 		for _, e := range validErr {
+			reason := e.Tag()
 			if f, exist := obj.Elem().FieldByName(e.Field()); exist && len(f.Tag.Get("msg")) > 0 {
 				isParamsError = true
-				msg = fmt.Sprintf("参数错误，%s", f.Tag.Get("msg"))
+				msg = zd_error.ParamsErrorMessage(c.Locale(), f.Tag.Get("msg"))
+				reason = f.Tag.Get("msg")
 			}
+			details.AddInvalidField(e.Field(), reason)
 		}
 	}
 	if isParamsError {
-		c.WriteJson(nil, zd_error.AddSpecialError(zd_error.ParamsErrorCode, msg))
+		c.WriteJson(nil, zd_error.AddSpecialError(zd_error.ParamsErrorCode, msg).WithDetails(details))
 	} else {
-		c.WriteJson(nil, zd_error.ParamsError)
+		c.WriteJson(nil, zd_error.ParamsError.WithDetails(details))
 	}
 }
 
@@ -0,0 +1,28 @@
+package http_ctx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lfxnxf/zdy_tools/zd_error"
+)
+
+func TestHttpContext_Locale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	ctx := &HttpContext{Context: c}
+	if got := ctx.Locale(); got != "en" {
+		t.Errorf("Locale() = %v, want en", got)
+	}
+
+	// Request的context中的locale优先
+	c.Request = c.Request.WithContext(zd_error.WithLocale(c.Request.Context(), "ja"))
+	if got := ctx.Locale(); got != "ja" {
+		t.Errorf("Locale() = %v, want ja", got)
+	}
+}
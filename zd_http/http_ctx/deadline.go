@@ -0,0 +1,14 @@
+//go:build go1.20
+// +build go1.20
+
+package http_ctx
+
+import (
+	"net/http"
+	"time"
+)
+
+// clearWriteDeadline 取消当前请求的写超时，长连接的流式响应不受HttpServer写超时限制
+func clearWriteDeadline(w http.ResponseWriter) error {
+	return http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,13 @@
+//go:build !go1.20
+// +build !go1.20
+
+package http_ctx
+
+import (
+	"net/http"
+)
+
+// clearWriteDeadline go1.20之前无法在不hijack连接的情况下修改写超时，流的总时长仍受HttpServer写超时限制
+func clearWriteDeadline(http.ResponseWriter) error {
+	return http.ErrNotSupported
+}
@@ -0,0 +1,72 @@
+package http_ctx
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientIdentityKey 上下文中的客户端身份key
+type clientIdentityKey struct{}
+
+// ClientIdentity 双向认证通过的客户端证书信息
+type ClientIdentity struct {
+	CommonName   string
+	Organization []string
+	DNSNames     []string
+	URIs         []string
+	Emails       []string
+	SerialNumber string
+	Certificate  *x509.Certificate
+}
+
+// ClientIdentityFromRequest 从已校验的证书链中取客户端身份，未校验返回nil
+func ClientIdentityFromRequest(r *http.Request) *ClientIdentity {
+	if r == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	id := &ClientIdentity{
+		CommonName:   cert.Subject.CommonName,
+		Organization: cert.Subject.Organization,
+		DNSNames:     cert.DNSNames,
+		Emails:       cert.EmailAddresses,
+		SerialNumber: cert.SerialNumber.String(),
+		Certificate:  cert,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	return id
+}
+
+// WithClientIdentity 将客户端身份写入上下文
+func WithClientIdentity(ctx context.Context, id *ClientIdentity) context.Context {
+	return context.WithValue(ctx, clientIdentityKey{}, id)
+}
+
+// GetClientIdentity 从上下文取客户端身份，非双向认证请求返回nil
+// gin的上下文从Request的context中读取
+func GetClientIdentity(ctx context.Context) *ClientIdentity {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return nil
+		}
+		ctx = c.Request.Context()
+	}
+	id, ok := ctx.Value(clientIdentityKey{}).(*ClientIdentity)
+	if !ok {
+		return nil
+	}
+	return id
+}
+
+// ClientIdentity 返回双向认证的客户端身份
+func (c *HttpContext) ClientIdentity() *ClientIdentity {
+	if id := GetClientIdentity(c.Context); id != nil {
+		return id
+	}
+	return ClientIdentityFromRequest(c.Request)
+}
@@ -0,0 +1,55 @@
+package http_ctx_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	"github.com/lfxnxf/zdy_tools/zd_http/http_ctx"
+	"github.com/lfxnxf/zdy_tools/zd_http/server"
+)
+
+func TestMain(m *testing.M) {
+	l := logging.New()
+	logging.DefaultKit = logging.NewKit(l, l, l, l, l, l)
+	os.Exit(m.Run())
+}
+
+// 经过HttpServer的中间件(access_log包装了ResponseWriter)时流仍不受写超时限制
+func TestHttpContext_SSEOutlivesWriteTimeout(t *testing.T) {
+	s := server.NewHttpServer(server.HttpServerConfig{Mode: gin.TestMode})
+	s.GET("/events", func(c *gin.Context) {
+		events := make(chan http_ctx.SSEvent)
+		go func() {
+			defer close(events)
+			for i := 0; i < 3; i++ {
+				time.Sleep(100 * time.Millisecond)
+				events <- http_ctx.SSEvent{Data: "progress"}
+			}
+		}()
+		_ = (&http_ctx.HttpContext{Context: c}).SSE(events, 0)
+	})
+	srv := httptest.NewUnstartedServer(s.Engine)
+	srv.Config.WriteTimeout = 150 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body after write timeout: %v", err)
+	}
+	if got, want := string(body), "data: progress\n\ndata: progress\n\ndata: progress\n\n"; got != want {
+		t.Errorf("SSE() body = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package http_ctx
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+)
+
+// SSEvent 一条Server-Sent Events消息
+type SSEvent struct {
+	Event string
+	Id    string
+	Retry time.Duration // 客户端重连间隔，0表示不下发
+	Data  interface{}   // string、[]byte原样输出，其余按json编码
+}
+
+// SSEWriter 逐条写入Server-Sent Events，每条写完立即flush
+type SSEWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// StartSSE 设置SSE响应头并返回写入器，并取消HttpServer的写超时
+func (c *HttpContext) StartSSE() *SSEWriter {
+	c.clearWriteDeadline()
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // 关闭nginx缓冲
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+	return &SSEWriter{
+		w:       c.Writer,
+		flusher: c.Writer,
+	}
+}
+
+// Send 发送一条事件
+func (s *SSEWriter) Send(ev SSEvent) error {
+	data, err := encodeStreamData(ev.Data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if len(ev.Id) > 0 {
+		buf.WriteString("id: ")
+		buf.WriteString(sseEscape(ev.Id))
+		buf.WriteByte('\n')
+	}
+	if len(ev.Event) > 0 {
+		buf.WriteString("event: ")
+		buf.WriteString(sseEscape(ev.Event))
+		buf.WriteByte('\n')
+	}
+	if ev.Retry > 0 {
+		buf.WriteString("retry: ")
+		buf.WriteString(strconv.FormatInt(int64(ev.Retry/time.Millisecond), 10))
+		buf.WriteByte('\n')
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		buf.WriteString("data: ")
+		buf.WriteString(strings.TrimSuffix(line, "\r"))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Comment 发送注释行，浏览器会忽略，常用作心跳
+func (s *SSEWriter) Comment(text string) error {
+	return s.write([]byte(": " + sseEscape(text) + "\n\n"))
+}
+
+func (s *SSEWriter) write(b []byte) error {
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// SSE 持续推送events中的事件，直到events关闭或客户端断开
+// heartbeat大于0时按间隔发送注释心跳，避免代理断开空闲连接，也用于及时发现客户端断开
+func (c *HttpContext) SSE(events <-chan SSEvent, heartbeat time.Duration) error {
+	w := c.StartSSE()
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	done := c.Request.Context().Done()
+	for {
+		select {
+		case <-done:
+			return c.Request.Context().Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := w.Send(ev); err != nil {
+				return err
+			}
+		case <-tick:
+			if err := w.Comment("ping"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// NDJSON 以换行分隔的json流推送items，直到items关闭或客户端断开
+func (c *HttpContext) NDJSON(items <-chan interface{}) error {
+	c.clearWriteDeadline()
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	done := c.Request.Context().Done()
+	for {
+		select {
+		case <-done:
+			return c.Request.Context().Err()
+		case item, ok := <-items:
+			if !ok {
+				return nil
+			}
+			b, err := jsoniter.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err = c.Writer.Write(append(b, '\n')); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// clearWriteDeadline 流的时长不固定，取消写超时，客户端断开由请求的ctx感知
+// 中间件包装的ResponseWriter需实现Unwrap，否则返回ErrNotSupported，流仍受HttpServer写超时限制
+func (c *HttpContext) clearWriteDeadline() {
+	if err := clearWriteDeadline(c.Writer); err != nil {
+		logging.Warnf("http stream %s clear write deadline failed, stream is limited by the server write timeout: %v", c.Request.URL.Path, err)
+	}
+}
+
+func encodeStreamData(data interface{}) ([]byte, error) {
+	switch v := data.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		return jsoniter.Marshal(v)
+	}
+}
+
+// sseEscape 去掉会破坏消息格式的换行
+func sseEscape(s string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+}
@@ -0,0 +1,106 @@
+package http_ctx
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHttpContext_SSE(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/events", nil)
+
+	events := make(chan SSEvent, 2)
+	events <- SSEvent{Event: "progress", Id: "1", Retry: 3 * time.Second, Data: map[string]int{"done": 50}}
+	events <- SSEvent{Data: "line1\nline2"}
+	close(events)
+
+	ctx := &HttpContext{Context: c}
+	if err := ctx.SSE(events, 0); err != nil {
+		t.Fatalf("SSE() error = %v", err)
+	}
+
+	want := "id: 1\nevent: progress\nretry: 3000\ndata: {\"done\":50}\n\n" +
+		"data: line1\ndata: line2\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("SSE() body = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream; charset=utf-8" {
+		t.Errorf("SSE() content type = %q", got)
+	}
+}
+
+func TestHttpContext_NDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/items", nil)
+
+	items := make(chan interface{}, 2)
+	items <- map[string]int{"id": 1}
+	items <- "done"
+	close(items)
+
+	ctx := &HttpContext{Context: c}
+	if err := ctx.NDJSON(items); err != nil {
+		t.Fatalf("NDJSON() error = %v", err)
+	}
+	if got, want := w.Body.String(), "{\"id\":1}\n\"done\"\n"; got != want {
+		t.Errorf("NDJSON() body = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/x-ndjson; charset=utf-8" {
+		t.Errorf("NDJSON() content type = %q", got)
+	}
+}
+
+func TestHttpContext_StreamClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	result := make(chan error, 1)
+	engine := gin.New()
+	engine.GET("/items", func(c *gin.Context) {
+		items := make(chan interface{})
+		go func() {
+			// 客户端断开前一直推送
+			for {
+				select {
+				case items <- "tick":
+					time.Sleep(10 * time.Millisecond)
+				case <-c.Request.Context().Done():
+					return
+				}
+			}
+		}()
+		result <- (&HttpContext{Context: c}).NDJSON(items)
+	})
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/items", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "\"tick\"\n" {
+		t.Fatalf("read first line %q, %v", line, err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err = <-result:
+		if err == nil {
+			t.Error("NDJSON() should return an error after client disconnect")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("NDJSON() did not return after client disconnect")
+	}
+}
@@ -13,21 +13,41 @@ import (
 	"time"
 )
 
+// 日志中记录的请求/响应body最大长度
+const maxLogBodySize = 512
+
+// responseWriter 只保留响应的前maxLogBodySize字节用于日志，流式响应不会堆积在内存中
 type responseWriter struct {
 	gin.ResponseWriter
 	b *bytes.Buffer
 }
 
 func (w responseWriter) Write(b []byte) (int, error) {
-	w.b.Write(b)
+	w.capture(b)
 	return w.ResponseWriter.Write(b)
 }
 
 func (w responseWriter) WriteString(s string) (int, error) {
-	w.b.WriteString(s)
+	w.capture([]byte(s))
 	return w.ResponseWriter.WriteString(s)
 }
 
+// Unwrap 供http.ResponseController找到底层连接，流式响应需要取消写超时
+func (w responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w responseWriter) capture(b []byte) {
+	n := maxLogBodySize - w.b.Len()
+	if n <= 0 {
+		return
+	}
+	if len(b) > n {
+		b = b[:n]
+	}
+	w.b.Write(b)
+}
+
 func loggingAccess() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.Method == http.MethodOptions ||
@@ -41,7 +61,7 @@ func loggingAccess() gin.HandlerFunc {
 			// response
 			writer := &responseWriter{
 				c.Writer,
-				bytes.NewBuffer([]byte{}),
+				bytes.NewBuffer(make([]byte, 0, maxLogBodySize)),
 			}
 			c.Writer = writer
 
@@ -64,14 +84,11 @@ func loggingAccess() gin.HandlerFunc {
 			// 服务名称
 			hostname, _ := os.Hostname()
 
-			if len(reqBody) >= 512 {
-				reqBody = reqBody[0:512]
+			if len(reqBody) >= maxLogBodySize {
+				reqBody = reqBody[0:maxLogBodySize]
 			}
 
 			var replyBody = writer.b.String()
-			if len(replyBody) >= 512 {
-				replyBody = replyBody[0:512]
-			}
 
 			logItems := []interface{}{
 				"start", nowTime.Format(utils.TimeFormatYYYYMMDDHHmmSS),
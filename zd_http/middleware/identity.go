@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/lfxnxf/zdy_tools/zd_http/http_ctx"
+)
+
+// 双向认证时把客户端证书身份写入上下文
+func clientIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id := http_ctx.ClientIdentityFromRequest(c.Request); id != nil {
+			c.Request = c.Request.WithContext(http_ctx.WithClientIdentity(c.Request.Context(), id))
+		}
+		c.Next()
+	}
+}
@@ -8,9 +8,10 @@ func GetOpts() []gin.HandlerFunc {
 	// todo max_connects
 	// todo prometheus
 	return []gin.HandlerFunc{
-		loggingAccess(), // 生成access_log
-		setTrace(),      // 设置trace
-		recoverSysMW(),  // recover
-		crossDomain(),   // 跨域设置
+		loggingAccess(),  // 生成access_log
+		setTrace(),       // 设置trace
+		recoverSysMW(),   // recover
+		crossDomain(),    // 跨域设置
+		clientIdentity(), // 客户端证书身份
 	}
 }
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/pprof"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	"github.com/lfxnxf/zdy_tools/zd_error"
+	"github.com/lfxnxf/zdy_tools/zd_http"
+)
+
+const (
+	AdminTokenHeader  = "X-Admin-Token"
+	defaultLoggerName = "default" // logging.SetLevelByString控制的默认logger
+	allLoggerName     = "all"
+)
+
+type AdminConfig struct {
+	Port     int64    `yaml:"port"`      // 管理端口，0表示不启用
+	Token    string   `yaml:"token"`     // 请求需在X-Admin-Token或Authorization: Bearer中携带
+	AllowIPs []string `yaml:"allow_ips"` // 允许访问的ip或网段，token和allow_ips都为空时只允许本机访问
+}
+
+type setLevelReq struct {
+	Logger   string `json:"logger" form:"logger"`     // 为空或all表示全部logger
+	Level    string `json:"level" form:"level"`       // debug、info、warn、error、fatal
+	Duration string `json:"duration" form:"duration"` // 自动恢复时间，如5m，为空不恢复
+}
+
+// levelController 记录被临时修改的日志级别，到期恢复
+type levelController struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	origin map[string]string
+}
+
+func newLevelController() *levelController {
+	return &levelController{
+		timers: make(map[string]*time.Timer),
+		origin: make(map[string]string),
+	}
+}
+
+func (lc *levelController) loggers() map[string]func(level string) {
+	setters := map[string]func(level string){
+		defaultLoggerName: logging.SetLevelByString,
+	}
+	for name, l := range logging.KitLoggers(logging.DefaultKit) {
+		setters[name] = l.SetLevelByString
+	}
+	return setters
+}
+
+func levels() map[string]string {
+	res := map[string]string{
+		defaultLoggerName: logging.GetLevel(),
+	}
+	for name, l := range logging.KitLoggers(logging.DefaultKit) {
+		res[name] = l.GetLevel()
+	}
+	return res
+}
+
+func (lc *levelController) set(names []string, level string, d time.Duration) {
+	setters := lc.loggers()
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	// 多个名字可能共用同一个logger，修改前一次读取所有级别
+	current := levels()
+	for _, name := range names {
+		if t, ok := lc.timers[name]; ok {
+			t.Stop()
+			delete(lc.timers, name)
+		}
+		if d <= 0 {
+			delete(lc.origin, name)
+			setters[name](level)
+			continue
+		}
+		// 多次临时修改时恢复到第一次修改前的级别
+		origin, ok := lc.origin[name]
+		if !ok {
+			origin = current[name]
+			lc.origin[name] = origin
+		}
+		setters[name](level)
+		lc.timers[name] = lc.revertAfter(name, origin, setters[name], d)
+	}
+}
+
+// revertAfter 到期后把name恢复到origin，调用方需持有lc.mu
+func (lc *levelController) revertAfter(name, origin string, setter func(level string), d time.Duration) *time.Timer {
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		lc.mu.Lock()
+		defer lc.mu.Unlock()
+		if lc.timers[name] != t {
+			return
+		}
+		delete(lc.timers, name)
+		delete(lc.origin, name)
+		setter(origin)
+		logging.Infow("log level reverted", zap.String("logger", name), zap.String("level", origin))
+	})
+	return t
+}
+
+func (lc *levelController) getLevel(c *gin.Context) {
+	zd_http.WriteJson(c, levels(), nil)
+}
+
+func (lc *levelController) setLevel(c *gin.Context) {
+	var req setLevelReq
+	if err := c.ShouldBind(&req); err != nil {
+		zd_http.WriteJson(c, nil, zd_error.ParamsError)
+		return
+	}
+	req.Level = strings.ToLower(req.Level)
+	if !logging.ValidLevel(req.Level) {
+		zd_http.WriteJson(c, nil, zd_error.ParamsError.WithDetails(zd_error.NewDetails().AddInvalidField("level", "unknown level")))
+		return
+	}
+	var d time.Duration
+	if len(req.Duration) > 0 {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d < 0 {
+			zd_http.WriteJson(c, nil, zd_error.ParamsError.WithDetails(zd_error.NewDetails().AddInvalidField("duration", "invalid duration")))
+			return
+		}
+	}
+
+	setters := lc.loggers()
+	names := []string{req.Logger}
+	if len(req.Logger) == 0 || req.Logger == allLoggerName {
+		names = names[:0]
+		for name := range setters {
+			names = append(names, name)
+		}
+	} else if _, ok := setters[req.Logger]; !ok {
+		zd_http.WriteJson(c, nil, zd_error.ParamsError.WithDetails(zd_error.NewDetails().AddInvalidField("logger", "unknown logger")))
+		return
+	}
+	lc.set(names, req.Level, d)
+	logging.Infow("log level changed", zap.Strings("loggers", names), zap.String("level", req.Level), zap.Duration("duration", d))
+	zd_http.WriteJson(c, levels(), nil)
+}
+
+// adminAuth 校验token或来源ip
+func adminAuth(cfg AdminConfig) gin.HandlerFunc {
+	var nets []*net.IPNet
+	for _, item := range cfg.AllowIPs {
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item += "/128"
+			} else {
+				item += "/32"
+			}
+		}
+		if _, n, err := net.ParseCIDR(item); err == nil {
+			nets = append(nets, n)
+		} else {
+			logging.Errorw("invalid admin allow ip", zap.String("ip", item), zap.Error(err))
+		}
+	}
+	return func(c *gin.Context) {
+		ip := net.ParseIP(c.RemoteIP())
+		if len(cfg.Token) > 0 {
+			token := c.GetHeader(AdminTokenHeader)
+			if len(token) == 0 {
+				token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+		}
+		if len(cfg.AllowIPs) > 0 || len(cfg.Token) == 0 {
+			if !ipAllowed(ip, nets, len(cfg.AllowIPs) == 0) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func ipAllowed(ip net.IP, nets []*net.IPNet, loopbackOnly bool) bool {
+	if ip == nil {
+		return false
+	}
+	if loopbackOnly {
+		return ip.IsLoopback()
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAdminEngine 管理路由，与业务流量端口隔离
+func newAdminEngine(cfg AdminConfig) *gin.Engine {
+	engine := gin.New()
+	engine.Use(gin.Recovery(), adminAuth(cfg))
+
+	pprof.Register(engine) // 性能
+
+	lc := newLevelController()
+	engine.GET("/debug/log/level", lc.getLevel)
+	engine.PUT("/debug/log/level", lc.setLevel)
+	engine.POST("/debug/log/level", lc.setLevel)
+	return engine
+}
+
+// Admin 返回管理路由，可在其上注册额外的调试接口，未配置admin端口时返回nil
+func (s *HttpServer) Admin() *gin.Engine {
+	return s.admin
+}
+
+// StartAdmin 启动管理端口，未配置或已经启动时直接返回
+// StartHttp、StartHttps会自动启动管理端口，一般无需单独调用
+func (s *HttpServer) StartAdmin() error {
+	if s.admin == nil {
+		return nil
+	}
+	started := false
+	s.adminOnce.Do(func() {
+		started = true
+	})
+	if !started {
+		return nil
+	}
+	adminServer := &http.Server{
+		Addr:           fmt.Sprintf(":%d", s.cfg.Admin.Port),
+		Handler:        s.admin,
+		ReadTimeout:    90 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+	s.mu.Lock()
+	if s.isShutdown() {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.adminServer = adminServer
+	s.mu.Unlock()
+	err := adminServer.ListenAndServe()
+	if err != nil {
+		logging.Errorw("start admin server failed", zap.Error(err))
+	}
+	return err
+}
+
+// startAdmin 与业务端口一起启动管理端口
+func (s *HttpServer) startAdmin() {
+	if s.admin != nil {
+		go s.StartAdmin()
+	}
+}
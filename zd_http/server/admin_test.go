@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		cfg    AdminConfig
+		remote string
+		header map[string]string
+		want   int
+	}{
+		{"loopback only", AdminConfig{}, "127.0.0.1:1234", nil, http.StatusOK},
+		{"loopback only remote", AdminConfig{}, "10.0.0.1:1234", nil, http.StatusForbidden},
+		{"token header", AdminConfig{Token: "secret"}, "10.0.0.1:1234", map[string]string{AdminTokenHeader: "secret"}, http.StatusOK},
+		{"bearer token", AdminConfig{Token: "secret"}, "10.0.0.1:1234", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"wrong token", AdminConfig{Token: "secret"}, "127.0.0.1:1234", map[string]string{AdminTokenHeader: "wrong"}, http.StatusUnauthorized},
+		{"missing token", AdminConfig{Token: "secret"}, "127.0.0.1:1234", nil, http.StatusUnauthorized},
+		{"allow cidr", AdminConfig{AllowIPs: []string{"10.0.0.0/8"}}, "10.1.2.3:1234", nil, http.StatusOK},
+		{"allow single ip", AdminConfig{AllowIPs: []string{"192.168.1.1"}}, "192.168.1.2:1234", nil, http.StatusForbidden},
+		{"allow ipv6", AdminConfig{AllowIPs: []string{"::1"}}, "[::1]:1234", nil, http.StatusOK},
+		{"token and ip", AdminConfig{Token: "secret", AllowIPs: []string{"10.0.0.0/8"}}, "172.16.0.1:1234", map[string]string{AdminTokenHeader: "secret"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(adminAuth(tt.cfg))
+			engine.GET("/debug", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/debug", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevelController_Revert(t *testing.T) {
+	logging.SetLevelByString("info")
+	defer logging.SetLevelByString("info")
+
+	engine := newAdminEngine(AdminConfig{})
+	req := httptest.NewRequest(http.MethodPut, "/debug/log/level",
+		strings.NewReader(`{"logger":"default","level":"debug","duration":"100ms"}`))
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("set level status %d, body %s", w.Code, w.Body.String())
+	}
+	if got := logging.GetLevel(); got != "debug" {
+		t.Fatalf("level %s after set, want debug", got)
+	}
+
+	for i := 0; i < 100 && logging.GetLevel() != "info"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := logging.GetLevel(); got != "info" {
+		t.Fatalf("level %s after duration, want info", got)
+	}
+
+	// 多次临时修改时恢复到第一次修改前的级别，不带duration的修改取消定时恢复
+	lc := newLevelController()
+	lc.set([]string{defaultLoggerName}, "warn", 50*time.Millisecond)
+	lc.set([]string{defaultLoggerName}, "error", 50*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	if got := logging.GetLevel(); got != "info" {
+		t.Fatalf("level %s after nested revert, want info", got)
+	}
+	lc.set([]string{defaultLoggerName}, "warn", 50*time.Millisecond)
+	lc.set([]string{defaultLoggerName}, "debug", 0)
+	time.Sleep(150 * time.Millisecond)
+	if got := logging.GetLevel(); got != "debug" {
+		t.Fatalf("level %s after permanent set, want debug", got)
+	}
+}
+
+func TestLevelController_SharedLogger(t *testing.T) {
+	kit := logging.DefaultKit
+	defer func() { logging.DefaultKit = kit }()
+	shared := logging.New()
+	shared.SetLevelByString("info")
+	logging.DefaultKit = logging.NewKit(shared, shared, shared, shared, shared, shared)
+
+	// 同一个logger挂在多个名字下，恢复时不能读到其他名字刚改过的级别
+	lc := newLevelController()
+	lc.set([]string{"access", "info", "debug"}, "debug", 50*time.Millisecond)
+	if got := shared.GetLevel(); got != "debug" {
+		t.Fatalf("level %s after set, want debug", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := shared.GetLevel(); got != "info" {
+		t.Fatalf("level %s after revert, want info", got)
+	}
+}
+
+func TestHttpServer_StartAdmin(t *testing.T) {
+	port, adminPort := freePort(t), freePort(t)
+	s := NewHttpServer(HttpServerConfig{
+		Port:  port,
+		Mode:  gin.TestMode,
+		Admin: AdminConfig{Port: adminPort},
+	})
+	go s.StartHttp()
+	defer s.Shutdown(context.Background())
+
+	// 管理端口随StartHttp启动，pprof只在管理端口
+	resp := waitGet(t, http.DefaultClient, localURL("http", adminPort)+"/debug/log/level")
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "default") {
+		t.Fatalf("admin got %d %s", resp.StatusCode, body)
+	}
+	resp = waitGet(t, http.DefaultClient, localURL("http", port)+"/debug/pprof/")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("pprof on public port got %d, want 404", resp.StatusCode)
+	}
+	if err := s.StartAdmin(); err != nil {
+		t.Fatalf("StartAdmin() after start = %v, want nil", err)
+	}
+}
@@ -3,16 +3,20 @@ package server
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
-	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
 
+	"github.com/lfxnxf/zdy_tools/discovery"
 	"github.com/lfxnxf/zdy_tools/logging"
 	"github.com/lfxnxf/zdy_tools/zd_http/http_ctx"
 	"github.com/lfxnxf/zdy_tools/zd_http/middleware"
+	"github.com/lfxnxf/zdy_tools/zd_http/ws"
 )
 
 const (
@@ -28,6 +32,16 @@ type HttpServerConfig struct {
 	HttpsPort   int64  `yaml:"https_port"`
 	Crt         string `yaml:"crt"`
 	Key         string `yaml:"key"`
+
+	CertReloadInterval int64  `yaml:"cert_reload_interval"` // 证书文件检查间隔（秒），默认10秒，小于0不热加载
+	ClientCA           string `yaml:"client_ca"`            // 客户端CA证书，配置后开启双向认证
+	ClientAuth         string `yaml:"client_auth"`          // require(默认)、verify_if_given
+	H2C                bool   `yaml:"h2c"`                  // http端口支持明文http2
+
+	Admin AdminConfig `yaml:"admin"` // 管理端口，pprof和日志级别等调试接口，随StartHttp、StartHttps启动
+
+	Register      discovery.RegisterConfig `yaml:"register"`       // 启动时注册http端口到consul，默认tcp健康检查
+	HttpsRegister discovery.RegisterConfig `yaml:"https_register"` // 单独注册https端口，服务名需与http不同，http检查使用https://，未开启时不注册
 }
 
 type HttpServer struct {
@@ -35,6 +49,17 @@ type HttpServer struct {
 	cfg         HttpServerConfig
 	server      *http.Server
 	httpsServer *http.Server
+
+	certReloader *certReloader
+
+	admin       *gin.Engine
+	adminServer *http.Server
+	adminOnce   sync.Once
+
+	mu            sync.Mutex
+	registrations []*discovery.Registration
+	done          chan struct{}
+	doneOnce      sync.Once
 }
 
 type HttpRoute struct {
@@ -50,9 +75,13 @@ func NewHttpServer(cfg HttpServerConfig) *HttpServer {
 	s := &HttpServer{
 		Engine: engine,
 		cfg:    cfg,
+		done:   make(chan struct{}),
 	}
 
-	pprof.Register(engine) // 性能
+	// pprof等调试接口只注册在管理端口
+	if cfg.Admin.Port > 0 {
+		s.admin = newAdminEngine(cfg.Admin)
+	}
 
 	// 初始化中间件
 	s.initPublicMiddleware()
@@ -60,47 +89,187 @@ func NewHttpServer(cfg HttpServerConfig) *HttpServer {
 }
 
 func (s *HttpServer) StartHttp() error {
-	s.server = &http.Server{
+	s.Engine.UseH2C = s.cfg.H2C
+	server := &http.Server{
 		Addr:           fmt.Sprintf(":%d", s.cfg.Port),
-		Handler:        s.Engine,
+		Handler:        s.Engine.Handler(),
 		ReadTimeout:    90 * time.Second,
 		WriteTimeout:   90 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
-	err := s.server.ListenAndServe()
+	s.mu.Lock()
+	if s.isShutdown() {
+		// Start之前已经调用了Shutdown
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.server = server
+	s.mu.Unlock()
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		logging.Errorw("start http server failed %v", zap.Error(err))
+		return err
+	}
+	// 端口监听成功后再注册，避免健康检查失败
+	if err = s.register(s.cfg.Register, s.cfg.Port); err != nil {
+		logging.Errorw("register http server failed", zap.Error(err))
+		_ = ln.Close()
+		return err
+	}
+	s.startAdmin()
+	err = server.Serve(ln)
 	if err != nil {
 		logging.Errorw("start http server failed %v", zap.Error(err))
 	}
 	return err
 }
 
+// register 配置开启时把端口注册到consul
+func (s *HttpServer) register(cfg discovery.RegisterConfig, port int64) error {
+	if !cfg.Enable {
+		return nil
+	}
+	registration, err := discovery.Register(cfg, s.cfg.ServiceName, int(port), "")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.isShutdown() {
+		// 注册期间调用了Shutdown
+		s.mu.Unlock()
+		registration.Deregister()
+		return nil
+	}
+	s.registrations = append(s.registrations, registration)
+	s.mu.Unlock()
+	return nil
+}
+
+// isShutdown 是否已经调用Shutdown，调用方需持有s.mu
+func (s *HttpServer) isShutdown() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkHttpsRegister https端口不能与http注册为同一服务，客户端按服务名只使用一种scheme
+func (s *HttpServer) checkHttpsRegister() error {
+	if !s.cfg.HttpsRegister.Enable || !s.cfg.Register.Enable {
+		return nil
+	}
+	name, httpsName := s.cfg.ServiceName, s.cfg.ServiceName
+	if len(s.cfg.Register.Name) > 0 {
+		name = s.cfg.Register.Name
+	}
+	if len(s.cfg.HttpsRegister.Name) > 0 {
+		httpsName = s.cfg.HttpsRegister.Name
+	}
+	if name == httpsName {
+		return fmt.Errorf("https register name %s is the same as http", httpsName)
+	}
+	return nil
+}
+
 func (s *HttpServer) StartHttps() error {
-	s.httpsServer = &http.Server{
+	if err := s.checkHttpsRegister(); err != nil {
+		logging.Errorw("start https server failed", zap.Error(err))
+		return err
+	}
+	tlsConfig, reloader, err := s.tlsConfig()
+	if err != nil {
+		logging.Errorw("start https server failed", zap.Error(err))
+		return err
+	}
+	httpsServer := &http.Server{
 		Addr:           fmt.Sprintf(":%d", s.cfg.HttpsPort),
 		Handler:        s.Engine,
 		ReadTimeout:    90 * time.Second,
 		WriteTimeout:   90 * time.Second,
 		MaxHeaderBytes: 1 << 20,
+		TLSConfig:      tlsConfig,
+	}
+	if err = http2.ConfigureServer(httpsServer, &http2.Server{}); err != nil {
+		logging.Errorw("configure http2 failed", zap.Error(err))
+		return err
 	}
-	err := s.httpsServer.ListenAndServeTLS(s.cfg.Crt, s.cfg.Key)
+	ln, err := net.Listen("tcp", httpsServer.Addr)
+	if err != nil {
+		logging.Errorw("start https server failed", zap.Error(err))
+		return err
+	}
+	s.mu.Lock()
+	if s.isShutdown() {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return http.ErrServerClosed
+	}
+	// 端口监听成功后才开始检查证书，由Shutdown停止
+	reloader.start()
+	s.httpsServer = httpsServer
+	s.certReloader = reloader
+	s.mu.Unlock()
+	if err = s.register(s.cfg.HttpsRegister, s.cfg.HttpsPort); err != nil {
+		logging.Errorw("register https server failed", zap.Error(err))
+		_ = ln.Close()
+		reloader.Stop()
+		return err
+	}
+	s.startAdmin()
+	// 证书由TLSConfig.GetCertificate提供
+	err = httpsServer.ServeTLS(ln, "", "")
 	if err != nil {
 		logging.Errorw("start http server failed %v", zap.Error(err))
 	}
 	return err
 }
 
+// Shutdown 先从consul注销，再等待进行中的请求结束
 func (s *HttpServer) Shutdown(ctx context.Context) {
-	err := s.server.Shutdown(ctx)
-	if err != nil {
-		fmt.Println(err)
+	s.mu.Lock()
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+	registrations := s.registrations
+	s.registrations = nil
+	server, httpsServer, adminServer, certReloader := s.server, s.httpsServer, s.adminServer, s.certReloader
+	s.mu.Unlock()
+
+	for _, registration := range registrations {
+		registration.Deregister()
+	}
+
+	if server != nil {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			fmt.Println(err)
+		}
 	}
 
-	if s.httpsServer != nil {
-		err = s.httpsServer.Shutdown(ctx)
+	if httpsServer != nil {
+		err := httpsServer.Shutdown(ctx)
 		if err != nil {
 			fmt.Println(err)
 		}
 	}
+
+	if adminServer != nil {
+		err := adminServer.Shutdown(ctx)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	if certReloader != nil {
+		certReloader.Stop()
+	}
+}
+
+// WebSocket 注册websocket路由，连接由hub统一管理
+func (s *HttpServer) WebSocket(relativePath string, hub *ws.Hub, handler ws.Handler, handlers ...gin.HandlerFunc) {
+	s.GET(relativePath, append(handlers, hub.Upgrade(handler))...)
 }
 
 func (s *HttpServer) initPublicMiddleware() {
@@ -1,21 +1,87 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
 	"github.com/gin-gonic/gin"
+
+	"github.com/lfxnxf/zdy_tools/discovery"
 	"github.com/lfxnxf/zdy_tools/logging"
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/registry"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/registry/static"
 	"github.com/lfxnxf/zdy_tools/zd_http"
-	"path/filepath"
-	"testing"
 )
 
-func TestHttpServer_Start(t *testing.T) {
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "zd_http_server")
+	if err != nil {
+		panic(err)
+	}
+	accessLog := logging.NewLogging(filepath.Join(dir, "access.log"))
+	l := logging.New()
+	logging.DefaultKit = logging.NewKit(accessLog, l, l, l, l, l)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// freePort 返回一个空闲端口
+func freePort(t *testing.T) int64 {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return int64(ln.Addr().(*net.TCPAddr).Port)
+}
 
-	accessLog := logging.NewLogging(filepath.Join("./", "access.log"))
-	logging.DefaultKit = logging.NewKit(accessLog, nil, nil, nil, nil, nil)
+func localURL(scheme string, port int64) string {
+	return fmt.Sprintf("%s://127.0.0.1:%d", scheme, port)
+}
 
+// waitListen 等待端口监听
+func waitListen(t *testing.T, port int64) {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s not listening", addr)
+}
+
+// waitGet 等待服务启动后发送请求
+func waitGet(t *testing.T, client *http.Client, url string) *http.Response {
+	var err error
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = client.Get(url); err == nil {
+			return resp
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("get %s failed: %v", url, err)
+	return nil
+}
+
+func TestHttpServer_Start(t *testing.T) {
+	port := freePort(t)
 	s := NewHttpServer(HttpServerConfig{
 		ServiceName: "test",
-		Port:        8888,
+		Port:        port,
 		Mode:        DebugMode,
 	})
 
@@ -30,7 +96,168 @@ func TestHttpServer_Start(t *testing.T) {
 		zd_http.WriteJson(c, resp, nil)
 	})
 
-	if err := s.Start(); err != nil {
-		logging.Fatalf("http server start failed, err %v", err)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.StartHttp()
+	}()
+	defer func() {
+		s.Shutdown(context.Background())
+		if err := <-errCh; err != http.ErrServerClosed {
+			t.Errorf("StartHttp() error = %v", err)
+		}
+	}()
+
+	resp := waitGet(t, http.DefaultClient, localURL("http", port)+"/test")
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "张三") {
+		t.Fatalf("got %d %s", resp.StatusCode, body)
+	}
+}
+
+// recordBackend 记录注册的服务名和健康检查
+type recordBackend struct {
+	registry.Backend
+	mu           sync.Mutex
+	registered   map[string]string // 服务名 -> check dsn
+	deregistered []string
+}
+
+func newRecordBackend(t *testing.T) *recordBackend {
+	backend, err := static.NewBackend("[]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &recordBackend{Backend: backend, registered: make(map[string]string)}
+	old := registry.Default
+	registry.Default = b
+	t.Cleanup(func() {
+		registry.Default = old
+	})
+	return b
+}
+
+func (b *recordBackend) Register(reg *upstream_config.Register) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.registered[reg.ServiceName] = reg.ServiceCheckDSN
+	return nil
+}
+
+func (b *recordBackend) Deregister(reg *upstream_config.Register) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deregistered = append(b.deregistered, reg.ServiceName)
+	return nil
+}
+
+func TestHttpServer_Register(t *testing.T) {
+	backend := newRecordBackend(t)
+	dir := t.TempDir()
+	crtFile, keyFile := newTestCert(t, "server", false, nil).write(t, dir, "server")
+	port, httpsPort := freePort(t), freePort(t)
+	s := NewHttpServer(HttpServerConfig{
+		ServiceName:   "test.register",
+		Port:          port,
+		HttpsPort:     httpsPort,
+		Mode:          gin.TestMode,
+		Crt:           crtFile,
+		Key:           keyFile,
+		Register:      discovery.RegisterConfig{Enable: true, Addr: "127.0.0.1"},
+		HttpsRegister: discovery.RegisterConfig{Enable: true, Name: "test.register_https", Addr: "127.0.0.1", CheckDSN: "https:///health"},
+	})
+	go s.StartHttp()
+	go s.StartHttps()
+
+	// http和https端口注册为不同的服务
+	registered := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.registrations)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for registered() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("registered %d ports, want 2", registered())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	backend.mu.Lock()
+	if _, ok := backend.registered["test.register"]; !ok {
+		t.Errorf("http port not registered: %v", backend.registered)
+	}
+	if dsn, want := backend.registered["test.register_https"], fmt.Sprintf("https://127.0.0.1:%d/health", httpsPort); dsn != want {
+		t.Errorf("https check dsn %q, want %q", dsn, want)
+	}
+	backend.mu.Unlock()
+	s.Shutdown(context.Background())
+	if n := registered(); n != 0 {
+		t.Fatalf("%d registrations left after shutdown", n)
+	}
+
+	// https与http同名时不启动
+	s = NewHttpServer(HttpServerConfig{
+		ServiceName:   "test.register",
+		HttpsPort:     freePort(t),
+		Mode:          gin.TestMode,
+		Crt:           crtFile,
+		Key:           keyFile,
+		Register:      discovery.RegisterConfig{Enable: true, Addr: "127.0.0.1"},
+		HttpsRegister: discovery.RegisterConfig{Enable: true, Addr: "127.0.0.1"},
+	})
+	if err := s.StartHttps(); err == nil {
+		t.Fatal("StartHttps() with the http service name should fail")
+	}
+
+	// 注册失败时不启动，管理端口也不启动
+	registry.Default = nil
+	s = NewHttpServer(HttpServerConfig{
+		ServiceName:   "test.register",
+		HttpsPort:     freePort(t),
+		Mode:          gin.TestMode,
+		Crt:           crtFile,
+		Key:           keyFile,
+		Admin:         AdminConfig{Port: freePort(t)},
+		HttpsRegister: discovery.RegisterConfig{Enable: true, Addr: "127.0.0.1"},
+	})
+	if err := s.StartHttps(); err != discovery.ErrNoRegistry {
+		t.Fatalf("StartHttps() error = %v, want ErrNoRegistry", err)
+	}
+	s.mu.Lock()
+	adminServer := s.adminServer
+	s.mu.Unlock()
+	if adminServer != nil {
+		t.Fatal("admin server started after register failed")
+	}
+}
+
+func TestHttpServer_RegisterAfterShutdown(t *testing.T) {
+	backend := newRecordBackend(t)
+	cfg := discovery.RegisterConfig{Enable: true, Addr: "127.0.0.1"}
+	s := NewHttpServer(HttpServerConfig{
+		ServiceName: "test.register_shutdown",
+		Port:        freePort(t),
+		Mode:        gin.TestMode,
+		Register:    cfg,
+	})
+	s.Shutdown(context.Background())
+	if err := s.StartHttp(); err != http.ErrServerClosed {
+		t.Fatalf("StartHttp() after shutdown error = %v, want ErrServerClosed", err)
+	}
+
+	// Shutdown注销之后才完成的注册立即注销
+	if err := s.register(cfg, freePort(t)); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	n := len(s.registrations)
+	s.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("%d registrations kept after shutdown", n)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if len(backend.deregistered) != 1 || backend.deregistered[0] != "test.register_shutdown" {
+		t.Fatalf("deregistered %v", backend.deregistered)
 	}
 }
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+)
+
+const (
+	ClientAuthRequire       = "require"         // 必须提供并校验客户端证书
+	ClientAuthVerifyIfGiven = "verify_if_given" // 提供了客户端证书才校验
+
+	defaultCertReloadInterval = 10 // 秒
+)
+
+// certReloader 定期检查证书文件修改时间，变化后重新加载，加载失败时继续使用旧证书
+type certReloader struct {
+	crtFile  string
+	keyFile  string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCertReloader(crtFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{
+		crtFile:  crtFile,
+		keyFile:  keyFile,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// start 开始检查证书文件，需调用Stop停止
+func (r *certReloader) start() {
+	if r.interval > 0 {
+		go r.watch()
+	}
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.crtFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.crtFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) watch() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				logging.Errorw("stat tls cert failed", zap.Error(err))
+				continue
+			}
+			r.mu.RLock()
+			changed := !modTime.Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err = r.reload(); err != nil {
+				logging.Errorw("reload tls cert failed", zap.String("crt", r.crtFile), zap.Error(err))
+				continue
+			}
+			logging.Infow("tls cert reloaded", zap.String("crt", r.crtFile))
+		}
+	}
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert := r.cert
+	r.mu.RUnlock()
+	return cert, nil
+}
+
+func (r *certReloader) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// tlsConfig 生成https配置，证书支持热加载，配置了ClientCA时开启双向认证
+// 返回的reloader未开始检查证书，端口监听成功后再start
+func (s *HttpServer) tlsConfig() (*tls.Config, *certReloader, error) {
+	interval := s.cfg.CertReloadInterval
+	if interval == 0 {
+		interval = defaultCertReloadInterval
+	}
+	reloader, err := newCertReloader(s.cfg.Crt, s.cfg.Key, time.Duration(interval)*time.Second)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load tls cert failed: %w", err)
+	}
+	cfg, err := s.clientAuthConfig(&tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, reloader, nil
+}
+
+// clientAuthConfig 配置了ClientCA时开启双向认证
+func (s *HttpServer) clientAuthConfig(cfg *tls.Config) (*tls.Config, error) {
+	if len(s.cfg.ClientCA) == 0 {
+		return cfg, nil
+	}
+
+	pem, err := ioutil.ReadFile(s.cfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca failed: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no valid certificate in client ca %s", s.cfg.ClientCA)
+	}
+	cfg.ClientCAs = pool
+	switch s.cfg.ClientAuth {
+	case "", ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthVerifyIfGiven:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("unknown client_auth %q", s.cfg.ClientAuth)
+	}
+	return cfg, nil
+}
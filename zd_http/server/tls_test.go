@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+
+	"github.com/lfxnxf/zdy_tools/zd_http/http_ctx"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	pem  []byte
+	kpem []byte
+}
+
+// newTestCert 生成证书，parent为空时自签名
+func newTestCert(t *testing.T, cn string, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"zdy"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{cn},
+
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	signer, signerKey := tmpl, crypto.Signer(key)
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, key.Public(), signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		kpem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}),
+	}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (crtFile, keyFile string) {
+	crtFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(crtFile, c.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, c.kpem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.pem, c.kpem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, "first", false, nil)
+	crtFile, keyFile := first.write(t, dir, "server")
+
+	r, err := newCertReloader(crtFile, keyFile, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.start()
+	defer r.Stop()
+	current := func() string {
+		cert, _ := r.GetCertificate(nil)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.Subject.CommonName
+	}
+	if cn := current(); cn != "first" {
+		t.Fatalf("cert %s, want first", cn)
+	}
+
+	// 写入损坏的证书时继续使用旧证书
+	future := time.Now().Add(time.Minute)
+	if err = ioutil.WriteFile(crtFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(crtFile, future, future)
+	time.Sleep(100 * time.Millisecond)
+	if cn := current(); cn != "first" {
+		t.Fatalf("cert %s after broken reload, want first", cn)
+	}
+
+	second := newTestCert(t, "second", false, nil)
+	second.write(t, dir, "server")
+	future = future.Add(time.Minute)
+	_ = os.Chtimes(crtFile, future, future)
+	_ = os.Chtimes(keyFile, future, future)
+	for i := 0; i < 50 && current() != "second"; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if cn := current(); cn != "second" {
+		t.Fatalf("cert %s, want second", cn)
+	}
+}
+
+func TestHttpServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", true, nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	crtFile, keyFile := newTestCert(t, "server", false, ca).write(t, dir, "server")
+	client := newTestCert(t, "order-service", false, ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		clientAuth string
+		certs      []tls.Certificate
+		wantErr    bool
+		wantCN     string
+	}{
+		{"require with cert", "", []tls.Certificate{client.tlsCertificate(t)}, false, "order-service"},
+		{"require without cert", ClientAuthRequire, nil, true, ""},
+		{"verify if given without cert", ClientAuthVerifyIfGiven, nil, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := freePort(t)
+			s := NewHttpServer(HttpServerConfig{
+				HttpsPort:  port,
+				Mode:       gin.TestMode,
+				Crt:        crtFile,
+				Key:        keyFile,
+				ClientCA:   caFile,
+				ClientAuth: tt.clientAuth,
+			})
+			s.GET("/whoami", func(c *gin.Context) {
+				cn := ""
+				if id := http_ctx.GetClientIdentity(c); id != nil {
+					cn = id.CommonName
+				}
+				c.String(http.StatusOK, "%s %s", c.Request.Proto, cn)
+			})
+			go s.StartHttps()
+			defer s.Shutdown(context.Background())
+
+			waitListen(t, port)
+			resp, err := newClient(tt.certs...).Get(localURL("https", port) + "/whoami")
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("request without client cert should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if want := "HTTP/2.0 " + tt.wantCN; string(body) != want {
+				t.Errorf("got %q, want %q", body, want)
+			}
+		})
+	}
+}
+
+func TestHttpServer_TLSConfigError(t *testing.T) {
+	dir := t.TempDir()
+	crtFile, keyFile := newTestCert(t, "server", false, nil).write(t, dir, "server")
+	s := NewHttpServer(HttpServerConfig{
+		Mode:     gin.TestMode,
+		Crt:      crtFile,
+		Key:      keyFile,
+		ClientCA: filepath.Join(dir, "missing.crt"),
+	})
+	if _, _, err := s.tlsConfig(); err == nil {
+		t.Fatal("tlsConfig() should fail with missing client ca")
+	}
+	if err := s.StartHttps(); err == nil {
+		t.Fatal("StartHttps() should fail with missing client ca")
+	}
+	if s.certReloader != nil || watchingCert() {
+		t.Fatal("cert reloader should not be kept after tlsConfig() failed")
+	}
+}
+
+// watchingCert 是否有证书检查协程，先等新建的协程开始运行，再等待已停止的协程退出
+func watchingCert() bool {
+	time.Sleep(50 * time.Millisecond)
+	buf := make([]byte, 1<<20)
+	for i := 0; i < 50; i++ {
+		if !strings.Contains(string(buf[:runtime.Stack(buf, true)]), "(*certReloader).watch") {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+func TestHttpServer_StartHttpsListenError(t *testing.T) {
+	dir := t.TempDir()
+	crtFile, keyFile := newTestCert(t, "server", false, nil).write(t, dir, "server")
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	s := NewHttpServer(HttpServerConfig{
+		HttpsPort:          int64(ln.Addr().(*net.TCPAddr).Port),
+		Mode:               gin.TestMode,
+		Crt:                crtFile,
+		Key:                keyFile,
+		CertReloadInterval: 1,
+	})
+	if err = s.StartHttps(); err == nil {
+		t.Fatal("StartHttps() should fail when the port is in use")
+	}
+	// 证书检查协程不会泄漏
+	if watchingCert() {
+		t.Fatal("cert reloader still running after StartHttps() failed")
+	}
+}
+
+func TestHttpServer_H2C(t *testing.T) {
+	port := freePort(t)
+	s := NewHttpServer(HttpServerConfig{Port: port, Mode: gin.TestMode, H2C: true})
+	s.GET("/proto", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Request.Proto)
+	})
+	go s.StartHttp()
+	defer s.Shutdown(context.Background())
+
+	// 明文http2
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	resp := waitGet(t, client, localURL("http", port)+"/proto")
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Fatalf("got proto %q, want HTTP/2.0", body)
+	}
+
+	// http/1.1仍然可用
+	resp = waitGet(t, http.DefaultClient, localURL("http", port)+"/proto")
+	defer resp.Body.Close()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if string(body) != "HTTP/1.1" {
+		t.Fatalf("got proto %q, want HTTP/1.1", body)
+	}
+}
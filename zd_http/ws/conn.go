@@ -0,0 +1,235 @@
+package ws
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+var (
+	ErrConnClosed     = errors.New("websocket conn closed")
+	ErrWriteQueueFull = errors.New("websocket write queue full")
+	ErrConnNotFound   = errors.New("websocket conn not found")
+)
+
+type message struct {
+	payloadType byte
+	data        []byte
+}
+
+// Conn 一个websocket连接，写操作进入队列由独立协程发送
+type Conn struct {
+	id  int64
+	uid int64
+	ws  *websocket.Conn
+	hub *Hub
+
+	send      chan message
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	info          interface{}
+	mu            sync.RWMutex
+	rooms         map[string]struct{}
+	lastHeartbeat int64
+}
+
+func newConn(id, uid int64, c *websocket.Conn, hub *Hub) *Conn {
+	return &Conn{
+		id:            id,
+		uid:           uid,
+		ws:            c,
+		hub:           hub,
+		send:          make(chan message, hub.cfg.WriteQueueSize),
+		closed:        make(chan struct{}),
+		rooms:         make(map[string]struct{}),
+		lastHeartbeat: time.Now().UnixNano(),
+	}
+}
+
+// ID 连接ID，进程内唯一
+func (c *Conn) ID() int64 {
+	return c.id
+}
+
+// Uid 升级时从上下文中取到的用户ID，未登录为0
+func (c *Conn) Uid() int64 {
+	return c.uid
+}
+
+// Request 返回升级时的http请求
+func (c *Conn) Request() *http.Request {
+	return c.ws.Request()
+}
+
+func (c *Conn) SetInfo(info interface{}) {
+	c.mu.Lock()
+	c.info = info
+	c.mu.Unlock()
+}
+
+func (c *Conn) Info() interface{} {
+	c.mu.RLock()
+	info := c.info
+	c.mu.RUnlock()
+	return info
+}
+
+// Rooms 返回连接当前加入的房间
+func (c *Conn) Rooms() []string {
+	c.mu.RLock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.mu.RUnlock()
+	return rooms
+}
+
+func (c *Conn) UpdateLastHeartbeat(t int64) {
+	atomic.StoreInt64(&c.lastHeartbeat, t)
+}
+
+func (c *Conn) LastHeartbeat() int64 {
+	return atomic.LoadInt64(&c.lastHeartbeat)
+}
+
+// WriteText 发送文本消息
+func (c *Conn) WriteText(data []byte) error {
+	return c.write(message{payloadType: websocket.TextFrame, data: data})
+}
+
+// WriteBinary 发送二进制消息
+func (c *Conn) WriteBinary(data []byte) error {
+	return c.write(message{payloadType: websocket.BinaryFrame, data: data})
+}
+
+// WriteJSON 按json编码后以文本消息发送
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, _, err := websocket.JSON.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteText(data)
+}
+
+// write 非阻塞入队，队列满时返回ErrWriteQueueFull，配置了CloseOnQueueFull则同时断开慢连接
+func (c *Conn) write(msg message) error {
+	select {
+	case <-c.closed:
+		return ErrConnClosed
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return nil
+	case <-c.closed:
+		return ErrConnClosed
+	default:
+		if c.hub.cfg.CloseOnQueueFull {
+			c.Close()
+		}
+		return ErrWriteQueueFull
+	}
+}
+
+// Close 关闭连接并从hub中移除，可重复调用
+func (c *Conn) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		_ = c.ws.Close()
+		c.hub.remove(c)
+	})
+}
+
+// Done 连接关闭时返回的channel会被关闭
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Conn) writeLoop() {
+	var tick <-chan time.Time
+	if c.hub.cfg.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(c.hub.cfg.HeartbeatInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-c.closed:
+			return
+		case msg := <-c.send:
+			if err := c.writeFrame(msg); err != nil {
+				c.Close()
+				return
+			}
+		case <-tick:
+			// 协议层ping，浏览器自动回pong，pong会刷新心跳，只接收消息的客户端也不会被判定为空闲
+			if err := c.writeFrame(message{payloadType: websocket.PingFrame}); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Conn) writeFrame(msg message) error {
+	if c.hub.cfg.WriteTimeout > 0 {
+		_ = c.ws.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteTimeout))
+	}
+	// 只有写协程修改PayloadType
+	c.ws.PayloadType = msg.payloadType
+	_, err := c.ws.Write(msg.data)
+	return err
+}
+
+func (c *Conn) readLoop(handler Handler) {
+	defer c.Close()
+	for {
+		data, err := c.receive()
+		if err != nil {
+			return
+		}
+		if handler != nil {
+			handler(c, data)
+		}
+	}
+}
+
+// receive 读取下一条数据消息
+// websocket.Message.Receive会直接丢弃pong，这里逐帧读取，收到任意帧（包括回复ping的pong）都刷新心跳
+func (c *Conn) receive() ([]byte, error) {
+	maxPayloadBytes := c.ws.MaxPayloadBytes
+	if maxPayloadBytes == 0 {
+		maxPayloadBytes = websocket.DefaultMaxPayloadBytes
+	}
+	for {
+		frame, err := c.ws.NewFrameReader()
+		if err != nil {
+			return nil, err
+		}
+		c.UpdateLastHeartbeat(time.Now().UnixNano())
+		// 控制帧由HandleFrame处理（ping自动回复pong），返回nil
+		frame, err = c.ws.HandleFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+		if frame == nil {
+			continue
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(frame, int64(maxPayloadBytes)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxPayloadBytes {
+			return nil, websocket.ErrFrameTooLarge
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,325 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	"github.com/lfxnxf/zdy_tools/utils"
+)
+
+const (
+	defaultWriteQueueSize    = 256
+	defaultWriteTimeout      = 10 * time.Second
+	defaultHeartbeatInterval = 30 * time.Second
+	defaultIdleTimeout       = 90 * time.Second
+	defaultMaxMessageBytes   = 1 << 20
+)
+
+// Handler 处理客户端发来的一条消息
+type Handler func(c *Conn, data []byte)
+
+type HubConfig struct {
+	WriteQueueSize    int           `yaml:"write_queue_size"`    // 每个连接的写队列长度
+	WriteTimeout      time.Duration `yaml:"write_timeout"`       // 单条消息写超时
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`  // 服务端ping间隔，小于0不发送
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // 超过该时间未收到客户端消息或pong则断开，小于0不检测
+	MaxMessageBytes   int           `yaml:"max_message_bytes"`   // 单条消息最大字节数
+	CloseOnQueueFull  bool          `yaml:"close_on_queue_full"` // 写队列满时断开慢连接，否则只丢弃消息
+
+	// CheckOrigin 校验握手请求，为空时不校验
+	CheckOrigin func(r *http.Request) bool `yaml:"-"`
+	// OnConnect、OnClose 连接建立、断开回调
+	OnConnect func(c *Conn) `yaml:"-"`
+	OnClose   func(c *Conn) `yaml:"-"`
+}
+
+func (cfg *HubConfig) setDefaults() {
+	if cfg.WriteQueueSize <= 0 {
+		cfg.WriteQueueSize = defaultWriteQueueSize
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaultWriteTimeout
+	}
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = defaultMaxMessageBytes
+	}
+}
+
+// Hub 管理websocket连接，支持按连接、用户、房间推送
+type Hub struct {
+	cfg HubConfig
+
+	conns  *sync.Map // connID -> *Conn
+	total  int64
+	nextID int64
+
+	mu    sync.RWMutex
+	users map[int64]map[int64]*Conn  // uid -> connID -> *Conn
+	rooms map[string]map[int64]*Conn // room -> connID -> *Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewHub(cfg HubConfig) *Hub {
+	cfg.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Hub{
+		cfg:    cfg,
+		conns:  new(sync.Map),
+		users:  make(map[int64]map[int64]*Conn),
+		rooms:  make(map[string]map[int64]*Conn),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if cfg.IdleTimeout > 0 {
+		go h.idleLoop()
+	}
+	return h
+}
+
+// Upgrade 返回将gin路由升级为websocket的处理函数，handler在读协程中同步调用
+func (h *Hub) Upgrade(handler Handler) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		uid := utils.GetUid(ctx)
+		srv := websocket.Server{
+			Handshake: func(config *websocket.Config, r *http.Request) error {
+				if h.cfg.CheckOrigin != nil && !h.cfg.CheckOrigin(r) {
+					return websocket.ErrBadWebSocketOrigin
+				}
+				return nil
+			},
+			Handler: func(wsConn *websocket.Conn) {
+				h.serve(wsConn, uid, handler)
+			},
+		}
+		srv.ServeHTTP(ctx.Writer, ctx.Request)
+		ctx.Abort()
+	}
+}
+
+func (h *Hub) serve(wsConn *websocket.Conn, uid int64, handler Handler) {
+	wsConn.MaxPayloadBytes = h.cfg.MaxMessageBytes
+	c := newConn(atomic.AddInt64(&h.nextID, 1), uid, wsConn, h)
+	h.add(c)
+	if h.cfg.OnConnect != nil {
+		h.cfg.OnConnect(c)
+	}
+	go c.writeLoop()
+	// 读循环占用当前协程，返回时websocket.Server会关闭底层连接
+	c.readLoop(handler)
+}
+
+func (h *Hub) add(c *Conn) {
+	atomic.AddInt64(&h.total, 1)
+	h.conns.Store(c.id, c)
+	if c.uid > 0 {
+		h.mu.Lock()
+		m, ok := h.users[c.uid]
+		if !ok {
+			m = make(map[int64]*Conn)
+			h.users[c.uid] = m
+		}
+		m[c.id] = c
+		h.mu.Unlock()
+	}
+}
+
+func (h *Hub) remove(c *Conn) {
+	if _, ok := h.conns.LoadAndDelete(c.id); !ok {
+		return
+	}
+	atomic.AddInt64(&h.total, -1)
+
+	h.mu.Lock()
+	if m, ok := h.users[c.uid]; ok {
+		delete(m, c.id)
+		if len(m) == 0 {
+			delete(h.users, c.uid)
+		}
+	}
+	for _, room := range c.Rooms() {
+		h.leaveLocked(room, c)
+	}
+	h.mu.Unlock()
+
+	if h.cfg.OnClose != nil {
+		h.cfg.OnClose(c)
+	}
+}
+
+// Size 当前连接数
+func (h *Hub) Size() int64 {
+	return atomic.LoadInt64(&h.total)
+}
+
+// Conn 按连接ID查找连接
+func (h *Hub) Conn(id int64) (*Conn, bool) {
+	v, ok := h.conns.Load(id)
+	if ok {
+		return v.(*Conn), ok
+	}
+	return nil, ok
+}
+
+// UserConns 返回用户的全部连接
+func (h *Hub) UserConns(uid int64) []*Conn {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return connList(h.users[uid])
+}
+
+// RoomConns 返回房间内的全部连接
+func (h *Hub) RoomConns(room string) []*Conn {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return connList(h.rooms[room])
+}
+
+// Join 连接加入房间
+func (h *Hub) Join(room string, c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+	m, ok := h.rooms[room]
+	if !ok {
+		m = make(map[int64]*Conn)
+		h.rooms[room] = m
+	}
+	m[c.id] = c
+	c.mu.Lock()
+	c.rooms[room] = struct{}{}
+	c.mu.Unlock()
+}
+
+// Leave 连接离开房间
+func (h *Hub) Leave(room string, c *Conn) {
+	h.mu.Lock()
+	h.leaveLocked(room, c)
+	h.mu.Unlock()
+}
+
+func (h *Hub) leaveLocked(room string, c *Conn) {
+	if m, ok := h.rooms[room]; ok {
+		delete(m, c.id)
+		if len(m) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+	c.mu.Lock()
+	delete(c.rooms, room)
+	c.mu.Unlock()
+}
+
+// Broadcast 向全部连接发送文本消息，except返回true的连接跳过
+func (h *Hub) Broadcast(data []byte, except func(connID int64) bool) {
+	h.conns.Range(func(k, v interface{}) bool {
+		c := v.(*Conn)
+		if except != nil && except(c.id) {
+			return true
+		}
+		h.writeLog(c, c.WriteText(data))
+		return true
+	})
+}
+
+// Unicast 向指定连接发送文本消息
+func (h *Hub) Unicast(id int64, data []byte) error {
+	c, ok := h.Conn(id)
+	if !ok {
+		return ErrConnNotFound
+	}
+	return c.WriteText(data)
+}
+
+// SendToUser 向用户的全部连接发送文本消息，返回成功入队的连接数
+func (h *Hub) SendToUser(uid int64, data []byte) int {
+	return h.multicast(h.UserConns(uid), data, nil)
+}
+
+// SendToRoom 向房间内连接发送文本消息，except返回true的连接跳过，返回成功入队的连接数
+func (h *Hub) SendToRoom(room string, data []byte, except func(connID int64) bool) int {
+	return h.multicast(h.RoomConns(room), data, except)
+}
+
+func (h *Hub) multicast(conns []*Conn, data []byte, except func(connID int64) bool) int {
+	var n int
+	for _, c := range conns {
+		if except != nil && except(c.id) {
+			continue
+		}
+		err := c.WriteText(data)
+		h.writeLog(c, err)
+		if err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *Hub) writeLog(c *Conn, err error) {
+	if err == ErrWriteQueueFull {
+		logging.Warnw("websocket write queue full", zap.Int64("conn_id", c.id), zap.Int64("uid", c.uid))
+	}
+}
+
+// Close 关闭全部连接并停止空闲检测
+func (h *Hub) Close() {
+	h.cancel()
+	h.conns.Range(func(k, v interface{}) bool {
+		v.(*Conn).Close()
+		return true
+	})
+}
+
+// idleLoop 定期断开超过IdleTimeout未收到消息的连接
+func (h *Hub) idleLoop() {
+	interval := h.cfg.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case now := <-ticker.C:
+			deadline := now.Add(-h.cfg.IdleTimeout).UnixNano()
+			h.conns.Range(func(k, v interface{}) bool {
+				c := v.(*Conn)
+				if c.LastHeartbeat() < deadline {
+					logging.Infow("websocket idle conn evicted", zap.Int64("conn_id", c.id), zap.Int64("uid", c.uid))
+					c.Close()
+				}
+				return true
+			})
+		}
+	}
+}
+
+func connList(m map[int64]*Conn) []*Conn {
+	conns := make([]*Conn, 0, len(m))
+	for _, c := range m {
+		conns = append(conns, c)
+	}
+	return conns
+}
@@ -0,0 +1,132 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/lfxnxf/zdy_tools/utils"
+)
+
+func dial(t *testing.T, srv *httptest.Server, uid string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?uid=" + uid
+	c, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	return c
+}
+
+func waitSize(t *testing.T, h *Hub, n int64) {
+	for i := 0; i < 100; i++ {
+		if h.Size() == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("hub size %d, want %d", h.Size(), n)
+}
+
+func TestHub(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := NewHub(HubConfig{})
+	defer hub.Close()
+
+	engine := gin.New()
+	engine.GET("/ws", func(ctx *gin.Context) {
+		if ctx.Query("uid") == "1" {
+			ctx.Set(utils.UidKey, int64(1))
+		}
+	}, hub.Upgrade(func(c *Conn, data []byte) {
+		if string(data) == "join" {
+			hub.Join("room", c)
+			_ = c.WriteText([]byte("joined"))
+			return
+		}
+		_ = c.WriteText(data)
+	}))
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	c1 := dial(t, srv, "1")
+	defer c1.Close()
+	c2 := dial(t, srv, "2")
+	defer c2.Close()
+	waitSize(t, hub, 2)
+
+	var msg string
+	_ = websocket.Message.Send(c1, "hello")
+	if err := websocket.Message.Receive(c1, &msg); err != nil || msg != "hello" {
+		t.Fatalf("echo got %q, %v", msg, err)
+	}
+
+	if n := hub.SendToUser(1, []byte("to-user")); n != 1 {
+		t.Fatalf("send to user got %d conns, want 1", n)
+	}
+	if err := websocket.Message.Receive(c1, &msg); err != nil || msg != "to-user" {
+		t.Fatalf("unicast got %q, %v", msg, err)
+	}
+
+	_ = websocket.Message.Send(c2, "join")
+	if err := websocket.Message.Receive(c2, &msg); err != nil || msg != "joined" {
+		t.Fatalf("join got %q, %v", msg, err)
+	}
+	if n := hub.SendToRoom("room", []byte("to-room"), nil); n != 1 {
+		t.Fatalf("send to room got %d conns, want 1", n)
+	}
+	if err := websocket.Message.Receive(c2, &msg); err != nil || msg != "to-room" {
+		t.Fatalf("room got %q, %v", msg, err)
+	}
+
+	c2.Close()
+	waitSize(t, hub, 1)
+	if conns := hub.RoomConns("room"); len(conns) != 0 {
+		t.Fatalf("room still has %d conns after close", len(conns))
+	}
+}
+
+func TestHubIdleEviction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := NewHub(HubConfig{IdleTimeout: 100 * time.Millisecond, HeartbeatInterval: -1})
+	defer hub.Close()
+
+	engine := gin.New()
+	engine.GET("/ws", hub.Upgrade(nil))
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	c := dial(t, srv, "")
+	defer c.Close()
+	waitSize(t, hub, 1)
+	time.Sleep(1500 * time.Millisecond)
+	waitSize(t, hub, 0)
+}
+
+func TestHubPongKeepsAlive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := NewHub(HubConfig{IdleTimeout: 200 * time.Millisecond, HeartbeatInterval: 50 * time.Millisecond})
+	defer hub.Close()
+
+	engine := gin.New()
+	engine.GET("/ws", hub.Upgrade(nil))
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	// 客户端只接收消息，读取时自动回复pong，从不发送数据消息
+	c := dial(t, srv, "")
+	defer c.Close()
+	go func() {
+		var msg string
+		for websocket.Message.Receive(c, &msg) == nil {
+		}
+	}()
+	waitSize(t, hub, 1)
+	time.Sleep(1500 * time.Millisecond)
+	if n := hub.Size(); n != 1 {
+		t.Fatalf("hub size %d, client answering pings should not be evicted", n)
+	}
+}
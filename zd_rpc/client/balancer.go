@@ -0,0 +1,116 @@
+package rpc_client
+
+import (
+	"sync/atomic"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/upstream"
+	"github.com/lfxnxf/zdy_tools/zd_error"
+)
+
+// BalancerName 由upstream集群选择节点的负载均衡，zdy://的target默认使用
+const BalancerName = "zdy_upstream"
+
+// 上报给异常检测的结果，0成功，1~100连接错误，101~200请求错误
+const (
+	resultSuccess      upstream.Result = 0
+	resultConnectError upstream.Result = 1
+	resultRequestError upstream.Result = 101
+)
+
+// chooseTimes 选中的节点还未建立连接时重新选择的次数
+const chooseTimes = 3
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(BalancerName, &pickerBuilder{}, base.Config{}))
+}
+
+type pickerBuilder struct{}
+
+func (b *pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &upstreamPicker{
+		conns: make(map[string]balancer.SubConn, len(info.ReadySCs)),
+		addrs: make([]string, 0, len(info.ReadySCs)),
+	}
+	for sc, sci := range info.ReadySCs {
+		if service, ok := sci.Address.BalancerAttributes.Value(serviceKey{}).(string); ok {
+			p.service = service
+		}
+		p.conns[sci.Address.Addr] = sc
+		p.addrs = append(p.addrs, sci.Address.Addr)
+	}
+	return p
+}
+
+// upstreamPicker 按集群的负载均衡策略选择节点，并把请求结果交给异常检测
+type upstreamPicker struct {
+	service string
+	conns   map[string]balancer.SubConn
+	addrs   []string
+	next    uint32
+}
+
+func (p *upstreamPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	for i := 0; i < chooseTimes; i++ {
+		host := clusterManager.ChooseHost(info.Ctx, p.service)
+		if host == nil {
+			break
+		}
+		if sc, ok := p.conns[host.Address()]; ok {
+			return p.result(sc, host.Address()), nil
+		}
+	}
+	// 集群中没有可用节点或节点未就绪时轮询已建立的连接
+	addr := p.addrs[atomic.AddUint32(&p.next, 1)%uint32(len(p.addrs))]
+	return p.result(p.conns[addr], addr), nil
+}
+
+func (p *upstreamPicker) result(sc balancer.SubConn, addr string) balancer.PickResult {
+	return balancer.PickResult{
+		SubConn: sc,
+		Done: func(info balancer.DoneInfo) {
+			// 被取消的请求(如对冲请求)不上报
+			if len(p.service) == 0 || status.Code(info.Err) == codes.Canceled {
+				return
+			}
+			clusterManager.PutResult(p.service, addr, int(resultOf(info.Err)))
+		},
+	}
+}
+
+// resultOf 业务错误不影响节点健康，只统计连接失败、超时和服务端异常
+func resultOf(err error) upstream.Result {
+	if isBusinessError(err) {
+		return resultSuccess
+	}
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return resultConnectError
+	case codes.DeadlineExceeded, codes.Internal, codes.ResourceExhausted, codes.DataLoss:
+		return resultRequestError
+	default:
+		return resultSuccess
+	}
+}
+
+// isBusinessError status是否携带zd_error的业务错误码，zd_error.ServerError等映射为Internal，但不是节点异常
+func isBusinessError(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetDomain() == zd_error.GRPCErrorDomain {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package rpc_client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/upstream"
+	"github.com/lfxnxf/zdy_tools/zd_error"
+)
+
+// fakeSubConn 只用于区分picker选中的连接
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func buildPicker(service string, addrs ...string) balancer.Picker {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	attrs := attributes.New(serviceKey{}, service)
+	for _, addr := range addrs {
+		info.ReadySCs[&fakeSubConn{addr: addr}] = base.SubConnInfo{
+			Address: resolver.Address{Addr: addr, BalancerAttributes: attrs},
+		}
+	}
+	return (&pickerBuilder{}).Build(info)
+}
+
+func pickAddr(t *testing.T, p balancer.Picker) string {
+	res, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.SubConn.(*fakeSubConn).addr
+}
+
+func TestPickerFallback(t *testing.T) {
+	if _, err := buildPicker("test.picker_empty").Pick(balancer.PickInfo{Ctx: context.Background()}); err != balancer.ErrNoSubConnAvailable {
+		t.Fatalf("got %v, want ErrNoSubConnAvailable", err)
+	}
+
+	// 集群不存在时轮询已建立的连接
+	p := buildPicker("test.picker_unknown", "127.0.0.1:9101", "127.0.0.1:9102")
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		counts[pickAddr(t, p)]++
+	}
+	if counts["127.0.0.1:9101"] != 5 || counts["127.0.0.1:9102"] != 5 {
+		t.Fatalf("fallback not round robin: %v", counts)
+	}
+
+	// 集群选中的节点没有连接时也轮询已建立的连接
+	initStaticService(t, "test.picker_other", "127.0.0.1:9201")
+	p = buildPicker("test.picker_other", "127.0.0.1:9101")
+	if addr := pickAddr(t, p); addr != "127.0.0.1:9101" {
+		t.Fatalf("got %s", addr)
+	}
+}
+
+func TestPickerChooseHost(t *testing.T) {
+	initStaticService(t, "test.picker", "127.0.0.1:9301", "127.0.0.1:9302")
+	// 连接只有9302时，集群选中9301会重新选择
+	p := buildPicker("test.picker", "127.0.0.1:9302")
+	for i := 0; i < 4; i++ {
+		if addr := pickAddr(t, p); addr != "127.0.0.1:9302" {
+			t.Fatalf("got %s", addr)
+		}
+	}
+}
+
+func TestResultOf(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want upstream.Result
+	}{
+		{nil, resultSuccess},
+		{errors.New("io"), resultSuccess},
+		{status.Error(codes.InvalidArgument, "bad"), resultSuccess},
+		{status.Error(codes.NotFound, "not found"), resultSuccess},
+		{status.Error(codes.Unavailable, "down"), resultConnectError},
+		{status.Error(codes.DeadlineExceeded, "timeout"), resultRequestError},
+		{status.Error(codes.Internal, "panic"), resultRequestError},
+		{zd_error.GRPCStatus(zd_error.ServerError).Err(), resultSuccess},
+		{status.Error(codes.ResourceExhausted, "limit"), resultRequestError},
+	} {
+		if got := resultOf(c.err); got != c.want {
+			t.Errorf("resultOf(%v) = %d, want %d", c.err, got, c.want)
+		}
+	}
+}
+
+func TestPickerReportResult(t *testing.T) {
+	conf := staticCluster("test.report", "127.0.0.1:9401", "127.0.0.1:9402", "127.0.0.1:9403")
+	conf.Detector.ConsecutiveConnectionError = 2
+	conf.Detector.ConsecutiveError = 2
+	conf.Detector.MaxEjectionPercent = 100
+	if err := InitServices([]upstream_config.Cluster{conf}); err != nil {
+		t.Fatal(err)
+	}
+	cluster := clusterManager.Cluster("test.report")
+	p := buildPicker("test.report", "127.0.0.1:9401", "127.0.0.1:9402", "127.0.0.1:9403")
+	done := func(addr string, err error) {
+		for {
+			res, _ := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+			if res.SubConn.(*fakeSubConn).addr == addr {
+				res.Done(balancer.DoneInfo{Err: err})
+				return
+			}
+		}
+	}
+	ejections := func(addr string) uint32 {
+		return cluster.GetHostByAddress(addr).GetDetectorMonitor().NumEjections()
+	}
+
+	// 取消和业务错误不影响节点，ServerError的状态码为Internal
+	for i := 0; i < 3; i++ {
+		done("127.0.0.1:9401", status.Error(codes.Canceled, "hedge"))
+		done("127.0.0.1:9401", status.Error(codes.InvalidArgument, "bad"))
+	}
+	for i := 0; i < 3; i++ {
+		done("127.0.0.1:9401", zd_error.GRPCStatus(zd_error.ServerError).Err())
+	}
+	if n := ejections("127.0.0.1:9401"); n != 0 {
+		t.Fatalf("ejected %d times by canceled and business errors", n)
+	}
+
+	// 连续的连接错误摘除节点
+	done("127.0.0.1:9402", status.Error(codes.Unavailable, "down"))
+	done("127.0.0.1:9402", status.Error(codes.Unavailable, "down"))
+	if n := ejections("127.0.0.1:9402"); n != 1 {
+		t.Fatalf("ejected %d times, want 1", n)
+	}
+	if n := ejections("127.0.0.1:9401"); n != 0 {
+		t.Fatalf("healthy host ejected %d times", n)
+	}
+	// 不带业务错误码的Internal为服务端异常
+	done("127.0.0.1:9403", status.Error(codes.Internal, "panic"))
+	done("127.0.0.1:9403", status.Error(codes.Internal, "panic"))
+	if n := ejections("127.0.0.1:9403"); n != 1 {
+		t.Fatalf("ejected %d times by internal errors, want 1", n)
+	}
+}
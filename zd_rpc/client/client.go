@@ -9,9 +9,10 @@ import (
 )
 
 type RpcClient struct {
-	conf         RpcClientConf
-	conn         *grpc.ClientConn
-	singleFlight syncx.SingleFlight
+	conf          RpcClientConf
+	conn          *grpc.ClientConn
+	singleFlight  syncx.SingleFlight
+	streamOptions []grpc.StreamClientInterceptor
 }
 
 func NewRpcClient(c RpcClientConf) *RpcClient {
@@ -22,8 +23,15 @@ func NewRpcClient(c RpcClientConf) *RpcClient {
 }
 
 type RpcClientConf struct {
-	Name    string `yaml:"name"`
-	Address string `yaml:"address"`
+	Name    string    `yaml:"name"`
+	Address string    `yaml:"address"`
+	Service string    `yaml:"service"` // 按服务名发现节点，配置后忽略Address
+	Hedge   HedgeConf `yaml:"hedge"`
+}
+
+// UseStream 添加流式请求的拦截器，需在GetRpcConn之前调用
+func (c *RpcClient) UseStream(options ...grpc.StreamClientInterceptor) {
+	c.streamOptions = append(c.streamOptions, options...)
 }
 
 func (c *RpcClient) GetRpcConn(options ...grpc.DialOption) *grpc.ClientConn {
@@ -32,8 +40,14 @@ func (c *RpcClient) GetRpcConn(options ...grpc.DialOption) *grpc.ClientConn {
 	}
 	_, _ = c.singleFlight.Do(c.conf.Name, func() (interface{}, error) {
 		opt := middleware.GetClientOpts()
+		if len(c.streamOptions) > 0 {
+			opt = append(opt, grpc.WithChainStreamInterceptor(c.streamOptions...))
+		}
+		if c.conf.Hedge.Enable {
+			opt = append(opt, WithHedge(c.conf.Hedge))
+		}
 		opt = append(opt, options...)
-		conn, err := grpc.Dial(c.conf.Address, opt...)
+		conn, err := grpc.Dial(c.target(), opt...)
 		if err != nil {
 			logging.Fatalf("did not connect: %v", err)
 			return nil, err
@@ -44,6 +58,14 @@ func (c *RpcClient) GetRpcConn(options ...grpc.DialOption) *grpc.ClientConn {
 	return c.conn
 }
 
+// target 配置了服务名时通过zdy://发现节点
+func (c *RpcClient) target() string {
+	if len(c.conf.Service) > 0 {
+		return Target(c.conf.Service)
+	}
+	return c.conf.Address
+}
+
 func (c *RpcClient) Close() {
 	_ = c.conn.Close()
 }
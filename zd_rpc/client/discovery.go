@@ -0,0 +1,142 @@
+package rpc_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/registry"
+	"github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/upstream"
+)
+
+// Scheme 服务发现的target前缀，如zdy:///account
+const Scheme = "zdy"
+
+var ErrServiceNotFound = errors.New("rpc client service not found")
+
+var (
+	clusterManager = upstream.NewClusterManager()
+	clusterMu      sync.Mutex
+)
+
+func init() {
+	resolver.Register(&resolverBuilder{})
+}
+
+// InitServices 按配置初始化服务发现集群，未配置的服务使用consul发现
+func InitServices(clusters []upstream_config.Cluster) error {
+	for _, c := range clusters {
+		if err := clusterManager.InitService(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClusterManager 返回rpc客户端使用的集群管理器
+func ClusterManager() *upstream.ClusterManager {
+	return clusterManager
+}
+
+// Target 服务名对应的dial target
+func Target(service string) string {
+	return Scheme + ":///" + service
+}
+
+// WithHash 一致性hash的key，配合hash负载均衡使用
+func WithHash(ctx context.Context, key interface{}) context.Context {
+	return upstream.NewContextWithHash(ctx, key)
+}
+
+// WithSubset 按tag选择子集，kvs为key、value交替
+func WithSubset(ctx context.Context, kvs ...string) context.Context {
+	return upstream.InjectSubsetCarrier(ctx, kvs)
+}
+
+func getCluster(service string) (*upstream.Cluster, error) {
+	if cluster := clusterManager.Cluster(service); cluster != nil {
+		return cluster, nil
+	}
+	if registry.Default == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, service)
+	}
+	clusterMu.Lock()
+	defer clusterMu.Unlock()
+	conf := upstream_config.NewCluster()
+	conf.Name = service
+	conf.EndpointsFrom = "consul"
+	if err := clusterManager.InitService(conf); err != nil {
+		return nil, err
+	}
+	return clusterManager.Cluster(service), nil
+}
+
+// serviceKey 地址的BalancerAttributes中保存服务名，picker据此找到集群
+type serviceKey struct{}
+
+type resolverBuilder struct{}
+
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	service := target.Endpoint()
+	if len(service) == 0 {
+		service = target.URL.Host
+	}
+	cluster, err := getCluster(service)
+	if err != nil {
+		return nil, err
+	}
+	r := &upstreamResolver{
+		service: service,
+		cc:      cc,
+	}
+	// 使用集群自身的节点列表，与http客户端共用同一个注册中心watch，并包含启动时的缓存和静态节点
+	r.stop = cluster.WatchHosts(r.update)
+	return r, nil
+}
+
+// upstreamResolver 从集群读取节点，选择节点由upstreamBalancer交给集群完成
+type upstreamResolver struct {
+	service string
+	cc      resolver.ClientConn
+	stop    func()
+	once    sync.Once
+}
+
+func (r *upstreamResolver) update(hosts []*upstream.Host) {
+	// 与集群一致，节点为空时忽略本次变更
+	if len(hosts) == 0 {
+		logging.Warnf("rpc client service %q active endpoints become size 0, ignore", r.service)
+		return
+	}
+	attrs := attributes.New(serviceKey{}, r.service)
+	addrs := make([]resolver.Address, 0, len(hosts))
+	for _, h := range hosts {
+		addrs = append(addrs, resolver.Address{
+			Addr:               h.Address(),
+			BalancerAttributes: attrs,
+		})
+	}
+	state := resolver.State{
+		Addresses:     addrs,
+		ServiceConfig: r.cc.ParseServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, BalancerName)),
+	}
+	if err := r.cc.UpdateState(state); err != nil {
+		logging.Warnf("rpc client service %q update state error %s", r.service, err)
+	}
+}
+
+func (r *upstreamResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *upstreamResolver) Close() {
+	r.once.Do(r.stop)
+}
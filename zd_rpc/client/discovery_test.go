@@ -0,0 +1,146 @@
+package rpc_client
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+
+	upstream_config "github.com/lfxnxf/zdy_tools/tpc/inf/go-upstream/config"
+)
+
+// startHealthServer 启动只有健康检查服务的grpc服务，hits统计收到的请求数
+func startHealthServer(t *testing.T, hits *int32) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		atomic.AddInt32(hits, 1)
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+// staticCluster 只使用静态节点的轮询集群
+func staticCluster(name string, addrs ...string) upstream_config.Cluster {
+	conf := upstream_config.NewCluster()
+	conf.Name = name
+	conf.LBType = "RoundRobin"
+	conf.StaticEndpoints = strings.Join(addrs, ",")
+	return conf
+}
+
+func initStaticService(t *testing.T, name string, addrs ...string) {
+	if err := InitServices([]upstream_config.Cluster{staticCluster(name, addrs...)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parseTarget(t *testing.T, service string) resolver.Target {
+	u, err := url.Parse(Target(service))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolver.Target{URL: *u}
+}
+
+// fakeClientConn 记录resolver推送的地址
+type fakeClientConn struct {
+	resolver.ClientConn
+	mu     sync.Mutex
+	states []resolver.State
+}
+
+func (cc *fakeClientConn) UpdateState(state resolver.State) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.states = append(cc.states, state)
+	return nil
+}
+
+func (cc *fakeClientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return &serviceconfig.ParseResult{}
+}
+
+func (cc *fakeClientConn) lastState() (resolver.State, int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if len(cc.states) == 0 {
+		return resolver.State{}, 0
+	}
+	return cc.states[len(cc.states)-1], len(cc.states)
+}
+
+func TestResolverBuild(t *testing.T) {
+	initStaticService(t, "test.resolver", "127.0.0.1:9001", "127.0.0.1:9002")
+
+	cc := new(fakeClientConn)
+	target := parseTarget(t, "test.resolver")
+	r, err := (&resolverBuilder{}).Build(target, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 集群启动时的节点(静态节点)在Build时立即推送
+	state, n := cc.lastState()
+	if n == 0 {
+		t.Fatal("resolver should push the cluster hosts on build")
+	}
+	var addrs []string
+	for _, addr := range state.Addresses {
+		if service, _ := addr.BalancerAttributes.Value(serviceKey{}).(string); service != "test.resolver" {
+			t.Fatalf("address %s service %q", addr.Addr, service)
+		}
+		addrs = append(addrs, addr.Addr)
+	}
+	if strings.Join(addrs, ",") != "127.0.0.1:9001,127.0.0.1:9002" {
+		t.Fatalf("got addresses %v", addrs)
+	}
+
+	// 未配置且没有注册中心的服务
+	if _, err = (&resolverBuilder{}).Build(parseTarget(t, "test.unknown"), cc, resolver.BuildOptions{}); err == nil {
+		t.Fatal("build unknown service without registry should fail")
+	}
+}
+
+func TestResolverDial(t *testing.T) {
+	var hits1, hits2 int32
+	addr1, addr2 := startHealthServer(t, &hits1), startHealthServer(t, &hits2)
+	// 已初始化的集群不会被替换，服务名带上端口避免重复运行时使用旧节点
+	service := "test.dial_" + addr1[strings.LastIndex(addr1, ":")+1:]
+	initStaticService(t, service, addr1, addr2)
+
+	conn, err := grpc.Dial(Target(service), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&hits1) == 0 || atomic.LoadInt32(&hits2) == 0 {
+		t.Fatalf("requests not balanced: %d, %d", hits1, hits2)
+	}
+}
@@ -0,0 +1,64 @@
+package rpc_client
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	"github.com/lfxnxf/zdy_tools/tools/hedge"
+)
+
+// HedgeConf 对冲请求配置，只对Methods中列出的方法生效，只应配置幂等的读接口
+// 对冲请求发往哪个节点由负载均衡决定，使用round_robin等策略时会落到不同节点
+// reply需实现protobuf APIv2的proto.Message，否则不对冲，首次调用时打印警告
+type HedgeConf struct {
+	hedge.Config `yaml:",inline"`
+	Methods      []string `yaml:"methods"` // 完整方法名，如/account.Account/GetTenant
+}
+
+// HedgeInterceptor 对冲请求拦截器，超过延迟仍未返回时再发送一次，先成功的结果生效
+func HedgeInterceptor(conf HedgeConf) grpc.UnaryClientInterceptor {
+	methods := make(map[string]struct{}, len(conf.Methods))
+	for _, m := range conf.Methods {
+		methods[m] = struct{}{}
+	}
+	var policies sync.Map // method -> *hedge.Policy
+	var warned sync.Map   // method -> struct{}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, hit := methods[method]; !hit {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		msg, ok := reply.(proto.Message)
+		if !ok {
+			if _, loaded := warned.LoadOrStore(method, struct{}{}); !loaded {
+				logging.Warnf("rpc hedge disabled for %s, reply %T is not a protobuf v2 message", method, reply)
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		v, loaded := policies.Load(method)
+		if !loaded {
+			v, _ = policies.LoadOrStore(method, hedge.NewPolicy(conf.Config))
+		}
+		res, err := v.(*hedge.Policy).Do(ctx, func(ctx context.Context, n int) (interface{}, error) {
+			// 每个请求解析到独立的reply，成功后再合并到调用方的reply
+			r := proto.Clone(msg)
+			proto.Reset(r)
+			return r, invoker(ctx, method, req, r, cc, opts...)
+		})
+		if err != nil {
+			return err
+		}
+		proto.Reset(msg)
+		proto.Merge(msg, res.(proto.Message))
+		return nil
+	}
+}
+
+// WithHedge 开启对冲请求
+func WithHedge(conf HedgeConf) grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(HedgeInterceptor(conf))
+}
@@ -0,0 +1,60 @@
+package rpc_client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/lfxnxf/zdy_tools/tools/hedge"
+)
+
+func TestHedgeInterceptor(t *testing.T) {
+	var calls int32
+	// 第一个请求阻塞到被取消，对冲请求立即返回
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		reply.(*wrapperspb.StringValue).Value = method
+		return nil
+	}
+	interceptor := HedgeInterceptor(HedgeConf{
+		Config:  hedge.Config{Enable: true, Delay: 20, BudgetPercent: 100},
+		Methods: []string{"/test.Echo/Get"},
+	})
+
+	reply := &wrapperspb.StringValue{}
+	if err := interceptor(context.Background(), "/test.Echo/Get", nil, reply, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 || reply.Value != "/test.Echo/Get" {
+		t.Fatalf("listed method called %d times, reply %q", n, reply.Value)
+	}
+
+	// 未列出的方法不对冲
+	atomic.StoreInt32(&calls, 0)
+	if err := interceptor(context.Background(), "/test.Echo/Set", nil, &wrapperspb.StringValue{}, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("unlisted method called %d times", n)
+	}
+
+	// 不配置Methods时不对冲任何方法
+	atomic.StoreInt32(&calls, 0)
+	interceptor = HedgeInterceptor(HedgeConf{Config: hedge.Config{Enable: true, Delay: 20, BudgetPercent: 100}})
+	if err := interceptor(context.Background(), "/test.Echo/Get", nil, &wrapperspb.StringValue{}, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("method without hedge config called %d times", n)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"math"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
@@ -62,3 +63,80 @@ func loggingAccess(ctx context.Context, req interface{}, info *grpc.UnaryServerI
 	logging.DefaultKit.A().Debugw("rpc_server", logItems...)
 	return resp, err
 }
+
+// accessServerStream 统计流中收发的消息数
+type accessServerStream struct {
+	grpc.ServerStream
+	recv int64
+	sent int64
+}
+
+func (s *accessServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.recv, 1)
+	}
+	return err
+}
+
+func (s *accessServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+	}
+	return err
+}
+
+// loggingStreamAccess 流结束时生成一条access_log，记录收发的消息数
+func loggingStreamAccess(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	// 当前时间
+	nowTime := time.Now()
+
+	stream := &accessServerStream{ServerStream: ss}
+	err := handler(srv, stream)
+
+	ctx := ss.Context()
+	// 获取trace_id
+	var traceId, realIp string
+	span, ok := ctx.Value(string(trace.CtxTraceSpanKey)).(trace.Span)
+	if ok {
+		traceId = span.Trace()
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		if traceList := md.Get(MdTraceIdKey); len(traceId) == 0 && len(traceList) > 0 {
+			traceId = traceList[0]
+		}
+		rips := md.Get("x-real-ip")
+		if len(rips) > 0 {
+			realIp = rips[0]
+		}
+	}
+	// 服务名称
+	hostname, _ := os.Hostname()
+
+	var rpcCode = 200
+	if err != nil {
+		rpcCode = 500
+	}
+
+	logItems := []interface{}{
+		"start", nowTime.Format(utils.TimeFormatYYYYMMDDHHmmSS),
+		"cost", math.Ceil(float64(time.Since(nowTime).Nanoseconds()) / 1e6),
+		"trace_id", traceId,
+		"host_ip", os.Getenv("FINAL_HOST"),
+		"host_name", hostname,
+		"req_method", info.FullMethod,
+		"real_ip", realIp,
+		"rpc_code", rpcCode,
+		"client_stream", info.IsClientStream,
+		"server_stream", info.IsServerStream,
+		"recv_count", atomic.LoadInt64(&stream.recv),
+		"send_count", atomic.LoadInt64(&stream.sent),
+	}
+	if err != nil {
+		logItems = append(logItems, "error", err.Error())
+	}
+	logging.DefaultKit.A().Debugw("rpc_server_stream", logItems...)
+	return err
+}
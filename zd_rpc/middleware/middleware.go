@@ -9,17 +9,30 @@ func GetServerOpts() []grpc.UnaryServerInterceptor {
 	// todo max_connects
 	// todo prometheus
 	return []grpc.UnaryServerInterceptor{
-		loggingAccess, // 生成access_log
+		errorStatusMW, // 错误码转换为grpc status
 		getTrace,      // 设置trace
+		loggingAccess, // 生成access_log
 		recoverSysMW,  // recover
 	}
 }
 
+func GetServerStreamOpts() []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		errorStatusStreamMW, // 错误码转换为grpc status
+		getStreamTrace,      // 设置trace
+		loggingStreamAccess, // 生成access_log
+		recoverStreamMW,     // recover
+	}
+}
+
 func GetClientOpts() []grpc.DialOption {
 	// todo max_connects
 	// todo prometheus
 	return []grpc.DialOption{
-		setTrace(), // 设置trace
+		setTrace(),           // 设置trace
+		setStreamTrace(),     // 设置流式请求的trace
+		convertError(),       // grpc status还原为业务错误
+		convertStreamError(), // 流式请求的grpc status还原为业务错误
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	}
 }
@@ -6,6 +6,8 @@ import (
 	"github.com/lfxnxf/zdy_tools/logging"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"runtime"
 )
 
@@ -21,3 +23,18 @@ func recoverSysMW(ctx context.Context, req interface{}, info *grpc.UnaryServerIn
 	}()
 	return handler(ctx, req)
 }
+
+// recoverStreamMW 流处理中的panic，记录日志后返回Internal错误
+func recoverStreamMW(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 64<<10)
+			buf = buf[:runtime.Stack(buf, false)]
+			panicErr := fmt.Errorf("grpc stream %s panic recovered: %v\n%s", info.FullMethod, r, buf)
+			logging.Errorw("mw_sys_recover_happen", zap.Error(panicErr), zap.String("method", info.FullMethod))
+			logging.CrashLog(panicErr)
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(srv, ss)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+
+	"github.com/lfxnxf/zdy_tools/zd_error"
+)
+
+// errorStatusMW 把业务错误码转换为grpc status，放在最外层，其他拦截器仍能取得原始错误
+func errorStatusMW(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, zd_error.GRPCStatus(err).Err()
+	}
+	return resp, nil
+}
+
+func errorStatusStreamMW(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := handler(srv, ss); err != nil {
+		return zd_error.GRPCStatus(err).Err()
+	}
+	return nil
+}
+
+// convertError 把下游返回的grpc status还原为业务错误
+func convertError() grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return zd_error.FromGRPCError(invoker(ctx, method, req, reply, cc, opts...))
+	})
+}
+
+func convertStreamError() grpc.DialOption {
+	return grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, zd_error.FromGRPCError(err)
+		}
+		return &errorClientStream{ClientStream: cs}, nil
+	})
+}
+
+// errorClientStream 流中收到的错误同样还原为业务错误
+type errorClientStream struct {
+	grpc.ClientStream
+}
+
+func (s *errorClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		return err
+	}
+	return zd_error.FromGRPCError(err)
+}
+
+func (s *errorClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == io.EOF {
+		return err
+	}
+	return zd_error.FromGRPCError(err)
+}
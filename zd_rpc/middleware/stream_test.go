@@ -0,0 +1,223 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+	"github.com/lfxnxf/zdy_tools/zd_error"
+	rpc_client "github.com/lfxnxf/zdy_tools/zd_rpc/client"
+	"github.com/lfxnxf/zdy_tools/zd_rpc/middleware"
+)
+
+// syncBuffer 并发写入的日志缓冲
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+var accessLog = new(syncBuffer)
+
+func TestMain(m *testing.M) {
+	l := logging.New()
+	access := logging.New()
+	access.SetOutput(accessLog)
+	logging.DefaultKit = logging.NewKit(access, l, l, l, l, l)
+	os.Exit(m.Run())
+}
+
+const (
+	echoMethod  = "/zd_rpc.test.Echo/Echo"
+	panicMethod = "/zd_rpc.test.Echo/Panic"
+	unaryMethod = "/zd_rpc.test.Echo/Unary"
+	blockMethod = "/zd_rpc.test.Echo/Block"
+)
+
+// echoServer 双向流，收到的消息原样返回，并返回服务端看到的trace
+type echoServer struct {
+	traceIds chan string
+	metadata chan metadata.MD
+}
+
+// unary 原样返回，并返回服务端收到的metadata
+func (s *echoServer) unary(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.metadata <- md
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: unaryMethod}, handler)
+}
+
+func (s *echoServer) echo(srv interface{}, ss grpc.ServerStream) error {
+	s.traceIds <- oteltrace.SpanContextFromContext(ss.Context()).TraceID().String()
+	for {
+		msg := new(wrapperspb.StringValue)
+		if err := ss.RecvMsg(msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := ss.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *echoServer) panic(srv interface{}, ss grpc.ServerStream) error {
+	panic("boom")
+}
+
+// block 一直等到流结束
+func (s *echoServer) block(srv interface{}, ss grpc.ServerStream) error {
+	<-ss.Context().Done()
+	return ss.Context().Err()
+}
+
+func newEchoDesc(s *echoServer) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "zd_rpc.test.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "Unary", Handler: s.unary},
+		},
+		Streams: []grpc.StreamDesc{
+			{StreamName: "Echo", Handler: s.echo, ServerStreams: true, ClientStreams: true},
+			{StreamName: "Panic", Handler: s.panic, ServerStreams: true, ClientStreams: true},
+			{StreamName: "Block", Handler: s.block, ServerStreams: true},
+		},
+	}
+}
+
+// setTestTracer 替换全局的TracerProvider和propagator，测试结束后恢复，返回记录的span
+func setTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	tp, prop := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(prop)
+	})
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+func TestStreamMiddleware(t *testing.T) {
+	setTestTracer(t)
+
+	lis := bufconn.Listen(1 << 20)
+	echo := &echoServer{traceIds: make(chan string, 1)}
+	server := grpc.NewServer(grpc.ChainStreamInterceptor(middleware.GetServerStreamOpts()...))
+	server.RegisterService(newEchoDesc(echo), echo)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	client := rpc_client.NewRpcClient(rpc_client.RpcClientConf{Name: "stream_test", Address: "bufnet"})
+	var intercepted int32
+	client.UseStream(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		atomic.AddInt32(&intercepted, 1)
+		return streamer(metadata.AppendToOutgoingContext(ctx, "x-real-ip", "10.0.0.1"), desc, cc, method, opts...)
+	})
+	conn := client.GetRpcConn(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	defer client.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+	desc := newEchoDesc(echo)
+
+	stream, err := conn.NewStream(ctx, &desc.Streams[0], echoMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		if err = stream.SendMsg(wrapperspb.String(v)); err != nil {
+			t.Fatal(err)
+		}
+		reply := new(wrapperspb.StringValue)
+		if err = stream.RecvMsg(reply); err != nil || reply.Value != v {
+			t.Fatalf("got %q, %v", reply.Value, err)
+		}
+	}
+	if err = stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.RecvMsg(new(wrapperspb.StringValue)); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+
+	traceId := parent.SpanContext().TraceID().String()
+	if got := <-echo.traceIds; got != traceId {
+		t.Fatalf("server trace %s, want %s", got, traceId)
+	}
+	if n := atomic.LoadInt32(&intercepted); n != 1 {
+		t.Fatalf("UseStream interceptor called %d times", n)
+	}
+
+	// panic转换为Internal
+	stream, err = conn.NewStream(ctx, &desc.Streams[1], panicMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.RecvMsg(new(wrapperspb.StringValue))
+	if code := zd_error.GRPCStatus(err).Code(); code != codes.Internal {
+		t.Fatalf("panic got %v (%v), want Internal", code, err)
+	}
+
+	server.GracefulStop()
+	logs := accessLog.String()
+	var echoLog, panicLog string
+	for _, line := range strings.Split(logs, "\n") {
+		switch {
+		case strings.Contains(line, echoMethod):
+			echoLog = line
+		case strings.Contains(line, panicMethod):
+			panicLog = line
+		}
+	}
+	for _, want := range []string{`"recv_count":3`, `"send_count":3`, `"real_ip":"10.0.0.1"`, `"trace_id":"` + traceId + `"`, `"rpc_code":200`} {
+		if !strings.Contains(echoLog, want) {
+			t.Errorf("echo access log %q missing %s", echoLog, want)
+		}
+	}
+	if !strings.Contains(panicLog, `"rpc_code":500`) {
+		t.Errorf("panic access log %q missing rpc_code 500", panicLog)
+	}
+}
@@ -2,39 +2,306 @@ package middleware
 
 import (
 	"context"
-	"github.com/lfxnxf/zdy_tools/trace"
+	"io"
+	"sync"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	gcodes "google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/lfxnxf/zdy_tools/trace"
+	"github.com/lfxnxf/zdy_tools/zd_error"
 )
 
+const tracerName = "zd_rpc"
+
 var MdTraceIdKey = "x-trace-id"
 var MdSpanIdKey = "x-span-id"
 
-// todo 拆分微服务时再接入open-trace，单体时模拟生成trace_id用来查询日志
-func getTrace(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	var traceId string
+// startServerSpan 从metadata中取上游的trace，没有w3c trace时兼容x-trace-id
+func startServerSpan(ctx context.Context, fullMethod string) (context.Context, oteltrace.Span) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if ok {
-		traceList := md.Get(MdTraceIdKey)
-		if len(traceList) > 0 {
-			traceId = traceList[0]
-		}
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	bags, sc := trace.Extract(ctx, otel.GetTextMapPropagator(), &md)
+	ctx = baggage.ContextWithBaggage(ctx, bags)
+	legacyTraceId, legacySpanId := firstValue(md, MdTraceIdKey), firstValue(md, MdSpanIdKey)
+	if !sc.IsValid() {
+		sc = legacySpanContext(legacyTraceId, legacySpanId)
 	}
-	if len(traceId) <= 0 {
-		ctx = trace.GenTrace(ctx, info.FullMethod)
+	if sc.IsValid() {
+		ctx = oteltrace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+
+	name, attrs := trace.SpanInfo(fullMethod, trace.PeerFromCtx(ctx))
+	ctx, span := otel.GetTracerProvider().Tracer(tracerName).Start(
+		ctx,
+		name,
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(attrs...),
+	)
+
+	// 日志中使用的trace_id
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		ctx = trace.GetContext(ctx, sc.TraceID().String(), sc.SpanID().String())
+	} else if len(legacyTraceId) > 0 {
+		ctx = trace.GetContext(ctx, legacyTraceId, legacySpanId)
+	}
+	return ctx, span
+}
+
+// legacySpanContext 旧版本只传x-trace-id、x-span-id，格式合法时作为上游span
+func legacySpanContext(traceId, spanId string) oteltrace.SpanContext {
+	tid, err := oteltrace.TraceIDFromHex(traceId)
+	if err != nil {
+		return oteltrace.SpanContext{}
+	}
+	sid, err := oteltrace.SpanIDFromHex(spanId)
+	if err != nil {
+		return oteltrace.SpanContext{}
+	}
+	return oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: oteltrace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// parentContext 取上游span，http服务端中间件把span放在gin上下文中
+func parentContext(ctx context.Context) context.Context {
+	if oteltrace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	if span, ok := ctx.Value(trace.CtxKeySpanContext).(oteltrace.Span); ok {
+		return oteltrace.ContextWithSpan(ctx, span)
+	}
+	return ctx
+}
+
+// startClientSpan 创建client span，并把trace注入metadata，同时保留x-trace-id
+func startClientSpan(ctx context.Context, method, target string) (context.Context, oteltrace.Span) {
+	name, attrs := trace.SpanInfo(method, target)
+	ctx, span := otel.GetTracerProvider().Tracer(tracerName).Start(
+		parentContext(ctx),
+		name,
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(attrs...),
+	)
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	trace.Inject(ctx, otel.GetTextMapPropagator(), &md)
+
+	traceId, spanId := trace.ExtraTraceID(ctx), ""
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		traceId = sc.TraceID().String()
+		spanId = sc.SpanID().String()
+	}
+	if len(traceId) > 0 {
+		md.Set(MdTraceIdKey, traceId)
+	}
+	if len(spanId) > 0 {
+		md.Set(MdSpanIdKey, spanId)
+	}
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// endSpan 记录grpc状态码，业务错误按转换后的状态码记录
+func endSpan(span oteltrace.Span, err error) {
+	if err == nil {
+		span.SetAttributes(trace.StatusCodeAttr(gcodes.OK))
+		span.End()
+		return
+	}
+	s := zd_error.GRPCStatus(err)
+	span.SetAttributes(trace.StatusCodeAttr(s.Code()))
+	span.SetStatus(otelcodes.Error, s.Message())
+	span.End()
+}
+
+func getTrace(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, span := startServerSpan(ctx, info.FullMethod)
+	trace.MessageReceived.Event(ctx, 1, req)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		trace.MessageSent.Event(ctx, 1, resp)
 	}
-	return handler(ctx, req)
+	endSpan(span, err)
+	return resp, err
 }
 
 func setTrace() grpc.DialOption {
 	return grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		span, ok := ctx.Value(string(trace.CtxTraceSpanKey)).(trace.Span)
-		if !ok || len(span.Trace()) <= 0 {
-			ctx = trace.GenTrace(ctx, method)
-			span, _ = ctx.Value(string(trace.CtxTraceSpanKey)).(trace.Span)
+		ctx, span := startClientSpan(ctx, method, cc.Target())
+		var p peer.Peer
+		opts = append(opts, grpc.Peer(&p))
+
+		trace.MessageSent.Event(ctx, 1, req)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			trace.MessageReceived.Event(ctx, 1, reply)
+		}
+		if p.Addr != nil {
+			span.SetAttributes(trace.PeerAttr(p.Addr.String())...)
+		}
+		endSpan(span, err)
+		return err
+	})
+}
+
+// traceServerStream 记录流中每条消息的事件
+type traceServerStream struct {
+	*grpc_middleware.WrappedServerStream
+	recv int
+	sent int
+}
+
+func (s *traceServerStream) RecvMsg(m interface{}) error {
+	err := s.WrappedServerStream.RecvMsg(m)
+	if err == nil {
+		s.recv++
+		trace.MessageReceived.Event(s.Context(), s.recv, m)
+	}
+	return err
+}
+
+func (s *traceServerStream) SendMsg(m interface{}) error {
+	err := s.WrappedServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+		trace.MessageSent.Event(s.Context(), s.sent, m)
+	}
+	return err
+}
+
+// getStreamTrace 与getTrace相同，并替换stream的context
+func getStreamTrace(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+	stream := grpc_middleware.WrapServerStream(ss)
+	stream.WrappedContext = ctx
+	err := handler(srv, &traceServerStream{WrappedServerStream: stream})
+	endSpan(span, err)
+	return err
+}
+
+// traceClientStream 记录消息事件，流结束或ctx取消时结束span
+type traceClientStream struct {
+	grpc.ClientStream
+	ctx           context.Context
+	span          oteltrace.Span
+	serverStreams bool
+	once          sync.Once
+	mu            sync.Mutex
+	recv          int
+	sent          int
+	receiving     int  // 进行中的RecvMsg，由RecvMsg按流的结果结束span
+	done          bool // 流的ctx已结束
+}
+
+func (s *traceClientStream) end(err error) {
+	s.once.Do(func() {
+		endSpan(s.span, err)
+	})
+}
+
+func (s *traceClientStream) RecvMsg(m interface{}) error {
+	s.mu.Lock()
+	s.receiving++
+	s.mu.Unlock()
+	err := s.ClientStream.RecvMsg(m)
+	s.mu.Lock()
+	s.receiving--
+	done := s.done
+	if err == nil {
+		s.recv++
+	}
+	id := s.recv
+	s.mu.Unlock()
+	switch {
+	case err == io.EOF:
+		s.end(nil)
+	case err != nil:
+		s.end(err)
+	default:
+		trace.MessageReceived.Event(s.ctx, id, m)
+		// 服务端只返回一条消息时，收到即结束
+		if !s.serverStreams {
+			s.end(nil)
+		} else if done {
+			s.end(s.ctxErr())
+		}
+	}
+	return err
+}
+
+// watch 流的ctx结束时(调用方取消、超时或流被关闭)结束span，
+// 正在RecvMsg时由RecvMsg按返回的结果结束
+func (s *traceClientStream) watch() {
+	<-s.ClientStream.Context().Done()
+	s.mu.Lock()
+	s.done = true
+	receiving := s.receiving > 0
+	s.mu.Unlock()
+	if !receiving {
+		s.end(s.ctxErr())
+	}
+}
+
+func (s *traceClientStream) ctxErr() error {
+	return status.FromContextError(s.ClientStream.Context().Err()).Err()
+}
+
+func (s *traceClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.mu.Lock()
+		s.sent++
+		id := s.sent
+		s.mu.Unlock()
+		trace.MessageSent.Event(s.ctx, id, m)
+	} else if err != io.EOF {
+		s.end(err)
+	}
+	return err
+}
+
+func setStreamTrace() grpc.DialOption {
+	return grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, method, cc.Target())
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+		stream := &traceClientStream{
+			ClientStream:  cs,
+			ctx:           ctx,
+			span:          span,
+			serverStreams: desc.ServerStreams,
 		}
-		md := metadata.Pairs(MdTraceIdKey, span.Trace(), MdSpanIdKey, span.Span())
-		ctx = metadata.NewOutgoingContext(ctx, md)
-		return invoker(ctx, method, req, reply, cc, opts...)
+		go stream.watch()
+		return stream, nil
 	})
 }
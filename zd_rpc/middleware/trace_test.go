@@ -0,0 +1,216 @@
+package middleware_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/lfxnxf/zdy_tools/trace"
+	rpc_client "github.com/lfxnxf/zdy_tools/zd_rpc/client"
+	"github.com/lfxnxf/zdy_tools/zd_rpc/middleware"
+)
+
+// startEchoServer 在bufconn上启动带服务端中间件的echo服务
+func startEchoServer(t *testing.T) (*echoServer, func(ctx context.Context, _ string) (net.Conn, error)) {
+	lis := bufconn.Listen(1 << 20)
+	echo := &echoServer{traceIds: make(chan string, 1), metadata: make(chan metadata.MD, 1)}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.GetServerOpts()...),
+		grpc.ChainStreamInterceptor(middleware.GetServerStreamOpts()...),
+	)
+	server.RegisterService(newEchoDesc(echo), echo)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return echo, func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+}
+
+// waitSpan 等待指定类型的span结束，只查找第since个之后结束的span
+func waitSpan(t *testing.T, recorder *tracetest.SpanRecorder, since int, kind oteltrace.SpanKind, name string) sdktrace.ReadOnlySpan {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, span := range recorder.Ended()[since:] {
+			if span.SpanKind() == kind && span.Name() == name {
+				return span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s span %s not ended", kind, name)
+	return nil
+}
+
+func attrOf(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// messageEvents 按顺序返回消息事件的类型
+func messageEvents(span sdktrace.ReadOnlySpan) []string {
+	var types []string
+	for _, event := range span.Events() {
+		for _, kv := range event.Attributes {
+			if kv.Key == trace.RPCMessageTypeKey {
+				types = append(types, kv.Value.AsString())
+			}
+		}
+	}
+	return types
+}
+
+func TestTraceUnary(t *testing.T) {
+	recorder := setTestTracer(t)
+	echo, dialer := startEchoServer(t)
+	client := rpc_client.NewRpcClient(rpc_client.RpcClientConf{Name: "trace_test", Address: "bufnet"})
+	conn := client.GetRpcConn(grpc.WithContextDialer(dialer))
+	defer client.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	out := new(wrapperspb.StringValue)
+	if err := conn.Invoke(ctx, unaryMethod, wrapperspb.String("a"), out); err != nil || out.Value != "a" {
+		t.Fatalf("got %q, %v", out.Value, err)
+	}
+	parent.End()
+
+	clientSpan := waitSpan(t, recorder, 0, oteltrace.SpanKindClient, "zd_rpc.test.Echo/Unary")
+	serverSpan := waitSpan(t, recorder, 0, oteltrace.SpanKindServer, "zd_rpc.test.Echo/Unary")
+	if clientSpan.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("client span should be a child of the caller span")
+	}
+	if serverSpan.SpanContext().TraceID() != parent.SpanContext().TraceID() ||
+		serverSpan.Parent().SpanID() != clientSpan.SpanContext().SpanID() || !serverSpan.Parent().IsRemote() {
+		t.Fatalf("server span parent %v, want remote client span %v", serverSpan.Parent(), clientSpan.SpanContext())
+	}
+
+	// w3c traceparent携带client span，x-trace-id保留给旧版本服务
+	md := <-echo.metadata
+	traceparent := strings.Join(md.Get("traceparent"), "")
+	if !strings.Contains(traceparent, clientSpan.SpanContext().TraceID().String()+"-"+clientSpan.SpanContext().SpanID().String()) {
+		t.Fatalf("traceparent %q does not carry the client span", traceparent)
+	}
+	if got := strings.Join(md.Get(middleware.MdTraceIdKey), ""); got != parent.SpanContext().TraceID().String() {
+		t.Fatalf("x-trace-id %q", got)
+	}
+
+	for _, span := range []sdktrace.ReadOnlySpan{clientSpan, serverSpan} {
+		if got := attrOf(span, "rpc.system").AsString(); got != "grpc" {
+			t.Errorf("%s rpc.system %q", span.SpanKind(), got)
+		}
+		if got := attrOf(span, "rpc.service").AsString(); got != "zd_rpc.test.Echo" {
+			t.Errorf("%s rpc.service %q", span.SpanKind(), got)
+		}
+		if got := attrOf(span, "rpc.method").AsString(); got != "Unary" {
+			t.Errorf("%s rpc.method %q", span.SpanKind(), got)
+		}
+		if got := attrOf(span, trace.GRPCStatusCodeKey); got.Type() != attribute.INT64 || got.AsInt64() != int64(codes.OK) {
+			t.Errorf("%s status code %v", span.SpanKind(), got.Emit())
+		}
+	}
+	if got := strings.Join(messageEvents(clientSpan), ","); got != "SENT,RECEIVED" {
+		t.Errorf("client message events %s", got)
+	}
+	if got := strings.Join(messageEvents(serverSpan), ","); got != "RECEIVED,SENT" {
+		t.Errorf("server message events %s", got)
+	}
+}
+
+func TestTraceLegacy(t *testing.T) {
+	recorder := setTestTracer(t)
+	echo, dialer := startEchoServer(t)
+	// 不带trace中间件的客户端，模拟只传x-trace-id的旧版本
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const (
+		traceId = "0af7651916cd43dd8448eb211c80319c"
+		spanId  = "b7ad6b7169203331"
+	)
+	call := func(ctx context.Context) sdktrace.ReadOnlySpan {
+		since := len(recorder.Ended())
+		if err := conn.Invoke(ctx, unaryMethod, wrapperspb.String("a"), new(wrapperspb.StringValue)); err != nil {
+			t.Fatal(err)
+		}
+		<-echo.metadata
+		return waitSpan(t, recorder, since, oteltrace.SpanKindServer, "zd_rpc.test.Echo/Unary")
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), middleware.MdTraceIdKey, traceId, middleware.MdSpanIdKey, spanId)
+	span := call(ctx)
+	if span.SpanContext().TraceID().String() != traceId || span.Parent().SpanID().String() != spanId {
+		t.Fatalf("server span %v parent %v, want legacy trace %s/%s", span.SpanContext(), span.Parent(), traceId, spanId)
+	}
+
+	// 同时存在时以w3c trace为准
+	const w3cTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx = metadata.AppendToOutgoingContext(ctx, "traceparent", "00-"+w3cTraceId+"-00f067aa0ba902b7-01")
+	span = call(ctx)
+	if span.SpanContext().TraceID().String() != w3cTraceId || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("server span %v parent %v, want w3c trace", span.SpanContext(), span.Parent())
+	}
+}
+
+func TestTraceStreamEnd(t *testing.T) {
+	recorder := setTestTracer(t)
+	_, dialer := startEchoServer(t)
+	desc := newEchoDesc(nil)
+
+	newStream := func(ctx context.Context, client *rpc_client.RpcClient) {
+		stream, err := client.GetRpcConn(grpc.WithContextDialer(dialer)).NewStream(ctx, &desc.Streams[2], blockMethod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = stream.SendMsg(wrapperspb.String("a")); err != nil {
+			t.Fatal(err)
+		}
+		if err = stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statusOf := func(span sdktrace.ReadOnlySpan) codes.Code {
+		if span.Status().Code != otelcodes.Error {
+			t.Fatalf("span status %v, want error", span.Status())
+		}
+		return codes.Code(attrOf(span, trace.GRPCStatusCodeKey).AsInt64())
+	}
+
+	// 调用方取消
+	client := rpc_client.NewRpcClient(rpc_client.RpcClientConf{Name: "trace_cancel", Address: "bufnet"})
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	newStream(ctx, client)
+	cancel()
+	if code := statusOf(waitSpan(t, recorder, 0, oteltrace.SpanKindClient, "zd_rpc.test.Echo/Block")); code != codes.Canceled {
+		t.Fatalf("canceled stream status %v", code)
+	}
+
+	// 调用方的ctx未结束，连接关闭时流也结束
+	since := len(recorder.Ended())
+	client = rpc_client.NewRpcClient(rpc_client.RpcClientConf{Name: "trace_close", Address: "bufnet"})
+	newStream(context.Background(), client)
+	client.Close()
+	if code := statusOf(waitSpan(t, recorder, since, oteltrace.SpanKindClient, "zd_rpc.test.Echo/Block")); code != codes.Canceled {
+		t.Fatalf("closed stream status %v", code)
+	}
+}
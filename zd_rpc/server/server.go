@@ -1,32 +1,74 @@
 package rpc_server
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 
+	"github.com/lfxnxf/zdy_tools/discovery"
+	"github.com/lfxnxf/zdy_tools/logging"
 	"github.com/lfxnxf/zdy_tools/zd_rpc/middleware"
 )
 
+const defaultHealthCheckInterval = 5 // 秒
+
 type register func(server *grpc.Server)
 
+// ReadinessCheck 就绪检查，返回错误时健康检查服务返回NOT_SERVING
+type ReadinessCheck func(ctx context.Context) error
+
 type RpcServer struct {
-	conf     RpcServerConfig
-	options  []grpc.UnaryServerInterceptor
-	register register
+	conf          RpcServerConfig
+	options       []grpc.UnaryServerInterceptor
+	streamOptions []grpc.StreamServerInterceptor
+	register      register
+
+	health *health.Server
+	checks []ReadinessCheck
+
+	mu           sync.Mutex
+	server       *grpc.Server
+	registration *discovery.Registration
+	done         chan struct{}
+	once         sync.Once
 }
 
 type RpcServerConfig struct {
 	ServiceName string `yaml:"service_name"`
 	Port        int64  `yaml:"port"`
+
+	Reflection          bool  `yaml:"reflection"`            // 注册反射服务，供grpcurl等工具使用
+	HealthCheckInterval int64 `yaml:"health_check_interval"` // 就绪检查间隔（秒），默认5秒
+
+	MaxRecvMsgSize int `yaml:"max_recv_msg_size"` // 接收消息的最大字节数，默认4MB
+	MaxSendMsgSize int `yaml:"max_send_msg_size"` // 发送消息的最大字节数，默认不限制
+
+	KeepaliveTime         int64 `yaml:"keepalive_time"`           // 连接空闲多久后发送ping（秒），默认2小时
+	KeepaliveTimeout      int64 `yaml:"keepalive_timeout"`        // ping的超时时间（秒），默认20秒
+	KeepaliveMinTime      int64 `yaml:"keepalive_min_time"`       // 允许客户端ping的最小间隔（秒），默认5分钟
+	PermitWithoutStream   bool  `yaml:"permit_without_stream"`    // 允许客户端在没有请求时ping
+	MaxConnectionIdle     int64 `yaml:"max_connection_idle"`      // 空闲连接的关闭时间（秒），默认不关闭
+	MaxConnectionAge      int64 `yaml:"max_connection_age"`       // 连接的最长存活时间（秒），到期后客户端重连，使负载重新均衡
+	MaxConnectionAgeGrace int64 `yaml:"max_connection_age_grace"` // 连接到期后等待请求结束的时间（秒）
+
+	Register discovery.RegisterConfig `yaml:"register"` // 启动时注册到consul，默认使用grpc健康检查
 }
 
 func NewRpcServer(conf RpcServerConfig, register register) *RpcServer {
 	return &RpcServer{
 		conf:     conf,
 		register: register,
+		health:   health.NewServer(),
+		done:     make(chan struct{}),
 	}
 }
 
@@ -34,27 +76,199 @@ func (r *RpcServer) Use(options ...grpc.UnaryServerInterceptor) {
 	r.options = append(r.options, options...)
 }
 
+// UseStream 添加流式接口的拦截器
+func (r *RpcServer) UseStream(options ...grpc.StreamServerInterceptor) {
+	r.streamOptions = append(r.streamOptions, options...)
+}
+
+// AddReadiness 添加就绪检查，如数据库、缓存的连通性，需在Start之前调用
+func (r *RpcServer) AddReadiness(checks ...ReadinessCheck) {
+	r.checks = append(r.checks, checks...)
+}
+
+// Health 健康检查服务，可手动设置各服务的状态
+func (r *RpcServer) Health() *health.Server {
+	return r.health
+}
+
 func (r *RpcServer) Start() error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", r.conf.Port))
 	if err != nil {
 		return err
 	}
+	return r.serve(lis)
+}
 
+func (r *RpcServer) serve(lis net.Listener) error {
 	opts := middleware.GetServerOpts()
 
 	opts = append(opts, r.options...)
 
-	// 拦截器
-	opt := grpc_middleware.WithUnaryServerChain(opts...)
+	streamOpts := middleware.GetServerStreamOpts()
+	streamOpts = append(streamOpts, r.streamOptions...)
 
-	rpcServe := grpc.NewServer(opt)
+	// 拦截器
+	serverOpts := append(r.serverOptions(),
+		grpc_middleware.WithUnaryServerChain(opts...),
+		grpc_middleware.WithStreamServerChain(streamOpts...),
+	)
+	rpcServe := grpc.NewServer(serverOpts...)
 
 	// 启动服务
 	r.register(rpcServe)
+	healthpb.RegisterHealthServer(rpcServe, r.health)
+	if r.conf.Reflection {
+		reflection.Register(rpcServe)
+	}
 
-	err = rpcServe.Serve(lis)
-	if err != nil {
-		return err
+	r.mu.Lock()
+	select {
+	case <-r.done:
+		// Start之前已经调用了Stop
+		r.mu.Unlock()
+		_ = lis.Close()
+		return nil
+	default:
+	}
+	r.server = rpcServe
+	r.mu.Unlock()
+
+	r.checkReadiness()
+	go r.watchReadiness()
+
+	if r.conf.Register.Enable {
+		registration, err := discovery.Register(r.conf.Register, r.conf.ServiceName, int(r.conf.Port), "grpc://")
+		if err != nil {
+			r.once.Do(func() {
+				close(r.done)
+			})
+			_ = lis.Close()
+			return err
+		}
+		r.mu.Lock()
+		select {
+		case <-r.done:
+			// 注册期间调用了Stop
+			r.mu.Unlock()
+			registration.Deregister()
+		default:
+			r.registration = registration
+			r.mu.Unlock()
+		}
 	}
-	return nil
+
+	return rpcServe.Serve(lis)
+}
+
+// Stop 先从consul注销，健康检查返回NOT_SERVING，再等待进行中的请求结束，ctx结束时强制关闭
+func (r *RpcServer) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	r.once.Do(func() {
+		close(r.done)
+	})
+	s := r.server
+	registration := r.registration
+	r.registration = nil
+	r.mu.Unlock()
+
+	registration.Deregister()
+	r.health.Shutdown()
+	if s == nil {
+		return nil
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		logging.Warnf("rpc server %s graceful stop timeout, force stop", r.conf.ServiceName)
+		s.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+func (r *RpcServer) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if r.conf.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(r.conf.MaxRecvMsgSize))
+	}
+	if r.conf.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(r.conf.MaxSendMsgSize))
+	}
+	opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+		MaxConnectionIdle:     seconds(r.conf.MaxConnectionIdle),
+		MaxConnectionAge:      seconds(r.conf.MaxConnectionAge),
+		MaxConnectionAgeGrace: seconds(r.conf.MaxConnectionAgeGrace),
+		Time:                  seconds(r.conf.KeepaliveTime),
+		Timeout:               seconds(r.conf.KeepaliveTimeout),
+	}))
+	if r.conf.KeepaliveMinTime > 0 || r.conf.PermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             seconds(r.conf.KeepaliveMinTime),
+			PermitWithoutStream: r.conf.PermitWithoutStream,
+		}))
+	}
+	return opts
+}
+
+func (r *RpcServer) watchReadiness() {
+	ticker := time.NewTicker(r.healthCheckInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.checkReadiness()
+		}
+	}
+}
+
+// checkReadiness 全部检查通过时所有服务为SERVING，否则为NOT_SERVING
+func (r *RpcServer) checkReadiness() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if len(r.checks) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), r.healthCheckInterval())
+		for _, check := range r.checks {
+			if err := check(ctx); err != nil {
+				logging.Warnf("rpc server %s readiness check failed: %v", r.conf.ServiceName, err)
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+				break
+			}
+		}
+		cancel()
+	}
+
+	// 空服务名表示整个server
+	r.health.SetServingStatus("", status)
+	if len(r.conf.ServiceName) > 0 {
+		r.health.SetServingStatus(r.conf.ServiceName, status)
+	}
+	r.mu.Lock()
+	s := r.server
+	r.mu.Unlock()
+	if s == nil {
+		return
+	}
+	for name := range s.GetServiceInfo() {
+		if name != healthpb.Health_ServiceDesc.ServiceName {
+			r.health.SetServingStatus(name, status)
+		}
+	}
+}
+
+func (r *RpcServer) healthCheckInterval() time.Duration {
+	if r.conf.HealthCheckInterval <= 0 {
+		return seconds(defaultHealthCheckInterval)
+	}
+	return seconds(r.conf.HealthCheckInterval)
+}
+
+func seconds(n int64) time.Duration {
+	return time.Duration(n) * time.Second
 }
@@ -0,0 +1,288 @@
+package rpc_server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/lfxnxf/zdy_tools/logging"
+)
+
+func TestMain(m *testing.M) {
+	l := logging.New()
+	logging.DefaultKit = logging.NewKit(l, l, l, l, l, l)
+	os.Exit(m.Run())
+}
+
+const (
+	testService = "zd_rpc.test.Wait"
+	waitMethod  = "/zd_rpc.test.Wait/Wait"
+)
+
+// waitServer 收到请求后通知entered，等待release后返回
+type waitServer struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *waitServer) wait(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		s.entered <- struct{}{}
+		<-s.release
+		return req, nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: waitMethod}, handler)
+}
+
+func (s *waitServer) desc() *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: testService,
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "Wait", Handler: s.wait}},
+	}
+}
+
+type testServer struct {
+	*RpcServer
+	wait   *waitServer
+	conn   *grpc.ClientConn
+	served chan error
+}
+
+// startTestServer 在bufconn上启动RpcServer
+func startTestServer(t *testing.T, conf RpcServerConfig, checks ...ReadinessCheck) *testServer {
+	w := &waitServer{entered: make(chan struct{}, 10), release: make(chan struct{})}
+	s := &testServer{
+		RpcServer: NewRpcServer(conf, func(server *grpc.Server) {
+			server.RegisterService(w.desc(), w)
+		}),
+		wait:   w,
+		served: make(chan error, 1),
+	}
+	s.AddReadiness(checks...)
+	lis := bufconn.Listen(1 << 20)
+	go func() {
+		s.served <- s.serve(lis)
+	}()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.conn = conn
+	t.Cleanup(func() {
+		conn.Close()
+		_ = s.Stop(context.Background())
+	})
+	return s
+}
+
+func (s *testServer) call(ctx context.Context, value string) (string, error) {
+	out := new(wrapperspb.StringValue)
+	err := s.conn.Invoke(ctx, waitMethod, wrapperspb.String(value), out, grpc.WaitForReady(true))
+	return out.Value, err
+}
+
+func (s *testServer) status(t *testing.T, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := s.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("health check %q: %v", service, err)
+	}
+	return resp.Status
+}
+
+func TestHealthStatus(t *testing.T) {
+	var ready int32
+	s := startTestServer(t, RpcServerConfig{ServiceName: "test.rpc", HealthCheckInterval: 1}, func(ctx context.Context) error {
+		if atomic.LoadInt32(&ready) == 0 {
+			return errors.New("not ready")
+		}
+		return nil
+	})
+
+	// 通过grpc健康检查服务查询，等待serve完成初始检查
+	client := healthpb.NewHealthClient(s.conn)
+	var resp *healthpb.HealthCheckResponse
+	var err error
+	for i := 0; i < 100; i++ {
+		resp, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: testService}, grpc.WaitForReady(true))
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("got %v, %v, want NOT_SERVING", resp, err)
+	}
+
+	// 检查通过后按间隔变为SERVING
+	atomic.StoreInt32(&ready, 1)
+	deadline := time.Now().Add(3 * time.Second)
+	for s.status(t, "") != healthpb.HealthCheckResponse_SERVING {
+		if time.Now().After(deadline) {
+			t.Fatal("health status not SERVING after readiness check passed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	for _, service := range []string{"test.rpc", testService} {
+		if got := s.status(t, service); got != healthpb.HealthCheckResponse_SERVING {
+			t.Fatalf("service %q got %v, want SERVING", service, got)
+		}
+	}
+
+	atomic.StoreInt32(&ready, 0)
+	s.checkReadiness()
+	if got := s.status(t, "test.rpc"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("got %v, want NOT_SERVING", got)
+	}
+
+	// Stop后一直为NOT_SERVING
+	atomic.StoreInt32(&ready, 1)
+	if err = s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.checkReadiness()
+	if got := s.status(t, ""); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("after stop got %v, want NOT_SERVING", got)
+	}
+	if err = <-s.served; err != nil {
+		t.Fatalf("serve returned %v", err)
+	}
+}
+
+func TestStopGraceful(t *testing.T) {
+	s := startTestServer(t, RpcServerConfig{ServiceName: "test.graceful"})
+	result := make(chan error, 1)
+	go func() {
+		value, err := s.call(context.Background(), "a")
+		if err == nil && value != "a" {
+			err = errors.New("got " + value)
+		}
+		result <- err
+	}()
+	<-s.wait.entered
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.Stop(context.Background())
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("stop returned %v before the request finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(s.wait.release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("in-flight request failed: %v", err)
+	}
+	if err := <-s.served; err != nil {
+		t.Fatalf("serve returned %v", err)
+	}
+}
+
+func TestStopForced(t *testing.T) {
+	s := startTestServer(t, RpcServerConfig{ServiceName: "test.forced"})
+	defer close(s.wait.release)
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.call(context.Background(), "a")
+		result <- err
+	}()
+	<-s.wait.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if cost := time.Since(start); cost < 100*time.Millisecond || cost > time.Second {
+		t.Fatalf("forced stop took %v", cost)
+	}
+	if code := status.Code(<-result); code != codes.Unavailable {
+		t.Fatalf("in-flight request got %v, want Unavailable", code)
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	s := NewRpcServer(RpcServerConfig{}, func(*grpc.Server) {})
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	lis := bufconn.Listen(1 << 10)
+	if err := s.serve(lis); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lis.Dial(); err == nil {
+		t.Fatal("listener should be closed")
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	s := startTestServer(t, RpcServerConfig{ServiceName: "test.options", Reflection: true, MaxRecvMsgSize: 64})
+	close(s.wait.release)
+	if _, err := s.call(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range s.wait.entered {
+		}
+	}()
+	_, err := s.call(context.Background(), strings.Repeat("a", 128))
+	if code := status.Code(err); code != codes.ResourceExhausted {
+		t.Fatalf("large message got %v, want ResourceExhausted", err)
+	}
+
+	s.mu.Lock()
+	info := s.server.GetServiceInfo()
+	s.mu.Unlock()
+	for _, service := range []string{testService, healthpb.Health_ServiceDesc.ServiceName, "grpc.reflection.v1alpha.ServerReflection"} {
+		if _, ok := info[service]; !ok {
+			t.Errorf("service %s not registered", service)
+		}
+	}
+
+	plain := startTestServer(t, RpcServerConfig{})
+	plain.mu.Lock()
+	for plain.server == nil {
+		plain.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		plain.mu.Lock()
+	}
+	info = plain.server.GetServiceInfo()
+	plain.mu.Unlock()
+	if _, ok := info["grpc.reflection.v1alpha.ServerReflection"]; ok {
+		t.Error("reflection registered without config")
+	}
+
+	opts := (&RpcServer{conf: RpcServerConfig{MaxRecvMsgSize: 1, MaxSendMsgSize: 1, KeepaliveMinTime: 1}}).serverOptions()
+	if len(opts) != 4 {
+		t.Errorf("got %d server options, want 4", len(opts))
+	}
+	if opts = (&RpcServer{}).serverOptions(); len(opts) != 1 {
+		t.Errorf("got %d default server options, want keepalive only", len(opts))
+	}
+}